@@ -0,0 +1,201 @@
+package ds2480
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Config is the configuration of a running chip.
+type Config struct {
+	Speed string        // Speed: standard, flexible, overdrive
+	PDSRC int           // Pull Down Slew Rate Control (Volts/uSecond)
+	PPD   time.Duration // Programming Pulse Duration
+	SPUD  time.Duration // Strong Pull Up Duration, SPUD_DYNAMIC for dynamic
+	W1LT  time.Duration // Write 1 Low Time
+	W0RT  time.Duration // Write 0 Recovery Time / Data Sample Offset
+	LOAD  int           // LOAD on the Bus (uA)
+	Baud  int           // BAUD rate of the serial interface
+	IRP   bool          // Inverse RXD Polarity
+}
+
+// ReadConfig reads the configuration parameters from the chip.  The speed is
+// the one last sent to the chip since it can't be read back.
+func (d *Ds2480) ReadConfig(ctx context.Context) (Config, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	params := []byte{CFG_PDSRC, CFG_PPD, CFG_SPUD, CFG_W1LT, CFG_W0RT, CFG_LOAD, CFG_BAUD}
+	tx := make([]byte, len(params))
+	for i, p := range params {
+		tx[i] = CMD_CONFIG | (CFG_READ << 4) | (p << 1)
+	}
+	rx := make([]byte, len(tx))
+
+	if err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, rx); nil != err {
+		return Config{}, err
+	}
+
+	v := make(map[byte]byte, len(params))
+	for i, p := range params {
+		if 0 != 0xf1&rx[i] {
+			d.resync(ctx)
+			return Config{}, ErrInvalidResponse
+		}
+		v[p] = 0x07 & (rx[i] >> 1)
+	}
+
+	d.chipBaud = 0x03 & v[CFG_BAUD]
+
+	cfg := Config{
+		Speed: speedName(d.chipSpeed),
+		Baud:  baudRates[d.chipBaud],
+		IRP:   0 != 0x04&v[CFG_BAUD],
+	}
+
+	var errs [6]error
+	cfg.PDSRC, errs[0] = intValue("PDSRC", pdsrcMap, v[CFG_PDSRC])
+	cfg.PPD, errs[1] = durationValue("PPD", ppdMap, v[CFG_PPD])
+	cfg.SPUD, errs[2] = durationValue("SPUD", spudMap, v[CFG_SPUD])
+	cfg.W1LT, errs[3] = durationValue("W1LT", w1ltMap, v[CFG_W1LT])
+	cfg.W0RT, errs[4] = durationValue("W0RT", w0rtMap, v[CFG_W0RT])
+	cfg.LOAD, errs[5] = intValue("LOAD", loadMap, v[CFG_LOAD])
+	for _, err := range errs {
+		if nil != err {
+			return Config{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// SetSpeedMode changes the speed used when the bus is not at overdrive:
+// standard, flexible or overdrive.
+func (d *Ds2480) SetSpeedMode(ctx context.Context, mode string) error {
+	if err := checkStringConfig("Speed", mode, speedMap); nil != err {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	speed := speedMap[mode]
+
+	// The bus is left at overdrive if it was switched there.
+	if speedMap["overdrive"] != d.speed || speedMap["overdrive"] == speedMap[d.Speed] {
+		tx := []byte{CMD_SEARCH_ACCEL_OFF | (speed << 2)}
+		if err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, nil); nil != err {
+			return err
+		}
+		d.speed = speed
+		d.chipSpeed = speed
+	}
+
+	d.Speed = mode
+	return nil
+}
+
+// SetPDSRC changes the pull down slew rate (Volts/uSecond).
+func (d *Ds2480) SetPDSRC(ctx context.Context, v int) error {
+	if err := checkIntConfig("PDSRC", v, pdsrcMap); nil != err {
+		return err
+	}
+	return d.setParam(ctx, CFG_PDSRC, pdsrcMap[v], func() {
+		d.PDSRC = v
+		d.pdsrc = pdsrcMap[v]
+	})
+}
+
+// SetSPUD changes the strong pull up duration.
+func (d *Ds2480) SetSPUD(ctx context.Context, v time.Duration) error {
+	if err := checkDurationConfig("SPUD", v, spudMap); nil != err {
+		return err
+	}
+	return d.setParam(ctx, CFG_SPUD, spudMap[v], func() {
+		d.SPUD = v
+		d.spud = spudMap[v]
+	})
+}
+
+// SetW1LT changes the write 1 low time.
+func (d *Ds2480) SetW1LT(ctx context.Context, v time.Duration) error {
+	if err := checkDurationConfig("W1LT", v, w1ltMap); nil != err {
+		return err
+	}
+	return d.setParam(ctx, CFG_W1LT, w1ltMap[v], func() {
+		d.W1LT = v
+		d.w1lt = w1ltMap[v]
+	})
+}
+
+// SetW0RT changes the write 0 recovery time / data sample offset.
+func (d *Ds2480) SetW0RT(ctx context.Context, v time.Duration) error {
+	if err := checkDurationConfig("W0RT", v, w0rtMap); nil != err {
+		return err
+	}
+	return d.setParam(ctx, CFG_W0RT, w0rtMap[v], func() {
+		d.W0RT = v
+		d.w0rt = w0rtMap[v]
+	})
+}
+
+// SetLOAD changes the load on the bus (uA).
+func (d *Ds2480) SetLOAD(ctx context.Context, v int) error {
+	if err := checkIntConfig("LOAD", v, loadMap); nil != err {
+		return err
+	}
+	return d.setParam(ctx, CFG_LOAD, loadMap[v], func() {
+		d.LOAD = v
+		d.load = loadMap[v]
+	})
+}
+
+// setParam writes the configuration parameter and calls update once the
+// chip has accepted it.
+func (d *Ds2480) setParam(ctx context.Context, param, value byte, update func()) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx := []byte{CMD_CONFIG | (param << 4) | (value << 1)}
+	rx := make([]byte, 1)
+
+	if err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, rx); nil != err {
+		return err
+	}
+	if (0xfe & tx[0]) != rx[0] {
+		d.resync(ctx)
+		return ErrInvalidResponse
+	}
+
+	update()
+	return nil
+}
+
+func speedName(speed byte) string {
+	for _, name := range []string{"standard", "flexible", "overdrive"} {
+		if speedMap[name] == speed {
+			return name
+		}
+	}
+	return ""
+}
+
+// intValue finds the setting for the value, ignoring the 0 default.
+func intValue(name string, m map[int]byte, v byte) (int, error) {
+	for k, got := range m {
+		if 0 != k && got == v {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: value %d is unknown", name, v)
+}
+
+// durationValue finds the setting for the value, ignoring the 0 default.
+func durationValue(name string, m map[time.Duration]byte, v byte) (time.Duration, error) {
+	for k, got := range m {
+		if 0 != k && got == v {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: value %d is unknown", name, v)
+}
@@ -0,0 +1,148 @@
+package ds2480
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/ds2480/emulator"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, _, _ := newEmulated(t)
+	d.SPUD = time.Hour
+	d.Baud = 57600
+	require.NoError(t, d.Init())
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	cfg, err := d.ReadConfig(ctx)
+	assert.NoError(err)
+	assert.Equal(Config{
+		Speed: "standard",
+		PDSRC: 1370,
+		PPD:   time.Microsecond * 512,
+		SPUD:  time.Hour,
+		W1LT:  time.Microsecond * 10,
+		W0RT:  time.Microsecond * 8,
+		LOAD:  1800,
+		Baud:  57600,
+	}, cfg)
+}
+
+func TestConfigValues(t *testing.T) {
+	assert := assert.New(t)
+
+	// Every value the chip can report is known
+	for v := byte(0); v < 8; v++ {
+		for name, m := range map[string]map[int]byte{"PDSRC": pdsrcMap, "LOAD": loadMap} {
+			_, err := intValue(name, m, v)
+			assert.NoError(err)
+		}
+		for name, m := range map[string]map[time.Duration]byte{
+			"PPD": ppdMap, "SPUD": spudMap, "W1LT": w1ltMap, "W0RT": w0rtMap,
+		} {
+			_, err := durationValue(name, m, v)
+			assert.NoError(err)
+		}
+	}
+
+	got, err := durationValue("SPUD", spudMap, 6)
+	assert.NoError(err)
+	assert.Equal(SPUD_DYNAMIC, got)
+
+	_, err = durationValue("SPUD", map[time.Duration]byte{time.Second: 1}, 6)
+	assert.Error(err)
+	_, err = intValue("LOAD", map[int]byte{1: 1}, 6)
+	assert.Error(err)
+}
+
+func TestReadConfigDynamic(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, e, _ := newEmulated(t)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	assert.NoError(d.SetSPUD(ctx, SPUD_DYNAMIC))
+	assert.Equal(byte(6), e.Config(emulator.ParamSPUD))
+
+	cfg, err := d.ReadConfig(ctx)
+	if assert.NoError(err) {
+		assert.Equal(SPUD_DYNAMIC, cfg.SPUD)
+	}
+}
+
+func TestSetParams(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, e, _ := newEmulated(t)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	assert.NoError(d.SetPDSRC(ctx, 830))
+	assert.NoError(d.SetW1LT(ctx, time.Microsecond*12))
+	assert.NoError(d.SetW0RT(ctx, time.Microsecond*4))
+	assert.NoError(d.SetLOAD(ctx, 3900))
+	assert.NoError(d.SetSPUD(ctx, time.Millisecond*131))
+
+	assert.Equal(byte(5), e.Config(emulator.ParamPDSRC))
+	assert.Equal(byte(4), e.Config(emulator.ParamW1LT))
+	assert.Equal(byte(1), e.Config(emulator.ParamW0RT))
+	assert.Equal(byte(7), e.Config(emulator.ParamLOAD))
+	assert.Equal(byte(2), e.Config(emulator.ParamSPUD))
+
+	// The configuration is kept for the next detect
+	assert.Equal(830, d.PDSRC)
+	assert.Equal(time.Millisecond*131, d.SPUD)
+	_, err = d.Detect()
+	require.NoError(t, err)
+	assert.Equal(byte(5), e.Config(emulator.ParamPDSRC))
+	assert.Equal(byte(2), e.Config(emulator.ParamSPUD))
+
+	// Invalid values are not sent
+	assert.Error(d.SetPDSRC(ctx, 1))
+	assert.Error(d.SetW1LT(ctx, time.Second))
+	assert.Error(d.SetW0RT(ctx, time.Second))
+	assert.Error(d.SetLOAD(ctx, 1))
+	assert.Error(d.SetSPUD(ctx, time.Second))
+	assert.Error(d.SetSpeedMode(ctx, "fast"))
+	assert.Equal(byte(5), e.Config(emulator.ParamPDSRC))
+}
+
+func TestSetSpeedMode(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t, "28.000000000001.--")
+	d, e, _ := newEmulated(t, sim.NewDevice(roms[0], nil))
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	assert.NoError(d.SetSpeedMode(ctx, "flexible"))
+	assert.Equal(byte(emulator.SpeedFlexible), e.Speed())
+	p, err := d.Reset()
+	assert.NoError(err)
+	assert.Equal(go1wire.PresenceDetected, p)
+	assert.Equal(byte(emulator.SpeedFlexible), e.Speed())
+
+	cfg, err := d.ReadConfig(ctx)
+	assert.NoError(err)
+	assert.Equal("flexible", cfg.Speed)
+
+	// At overdrive the new mode is used once back to standard
+	assert.NoError(d.SetSpeed(ctx, go1wire.SpeedOverdrive))
+	assert.NoError(d.SetSpeedMode(ctx, "standard"))
+	assert.Equal(byte(emulator.SpeedOverdrive), e.Speed())
+	assert.NoError(d.SetSpeed(ctx, go1wire.SpeedStandard))
+	assert.Equal(byte(emulator.SpeedStandard), e.Speed())
+}
@@ -1,14 +1,15 @@
 package ds2480
 
 import (
-	//"encoding/hex"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/schmidtw/go1wire"
-	serial "github.com/schmidtw/go232"
 )
 
 const (
@@ -41,7 +42,14 @@ const (
 	CHIP_MODE__DATA    = iota
 )
 
-var ErrInvalidResponse = errors.New("invalid response")
+// How long a read from the port waits for data before returning so the
+// context can be checked.
+const readPoll = time.Millisecond * 100
+
+// How long to wait for the chip to answer at a new baud rate.
+const baudTimeout = time.Millisecond * 250
+
+var ErrInvalidResponse = go1wire.ErrInvalidResponse
 var ErrInvalidState = errors.New("file already open")
 
 var speedMap = map[string]byte{
@@ -78,6 +86,10 @@ var ppdMap = map[time.Duration]byte{
 	time.Hour * 1:           7, // Forever
 }
 
+// SPUD_DYNAMIC is the Strong Pull Up Duration of the chip's dynamic setting,
+// which has no fixed duration.
+const SPUD_DYNAMIC = time.Duration(-1)
+
 // Strong Pull Up Duration - defined in DS2480B.pdf page 13
 var spudMap = map[time.Duration]byte{
 	time.Hour * 0:            4, // Make the 0 value the default value
@@ -87,6 +99,7 @@ var spudMap = map[time.Duration]byte{
 	time.Millisecond * 262:   3,
 	time.Millisecond * 524:   4, // Default Std, Flex, Overdrive
 	time.Millisecond * 1048:  5,
+	SPUD_DYNAMIC:             6, // Dynamic
 	time.Hour * 1:            7, // Forever
 }
 
@@ -129,6 +142,14 @@ var loadMap = map[int]byte{
 	3900: 7,
 }
 
+// Reset result bits - defined in DS2480B.pdf page 9
+var presenceMap = map[byte]go1wire.PresenceResult{
+	0: go1wire.PresenceShorted,
+	1: go1wire.PresenceDetected,
+	2: go1wire.PresenceAlarming,
+	3: go1wire.PresenceNone,
+}
+
 // Desired BAUD rate to run the 1-wire system at
 var baudMap = map[int]byte{
 	0:      0, // Make the 0 value the default value
@@ -139,6 +160,14 @@ var baudMap = map[int]byte{
 	// The rest are duplicates...
 }
 
+// The baud rates by the value of the baud configuration parameter.
+var baudRates = map[byte]int{
+	0: 9600,
+	1: 19200,
+	2: 57600,
+	3: 115200,
+}
+
 type Ds2480 struct {
 	// Configuration Section
 	Name  string        // The filename for the serial interface
@@ -152,6 +181,9 @@ type Ds2480 struct {
 	Baud  int           // Desired BAUD rate to run the 1-wire system at
 	SPU   bool          // Strong Pull Up (if true)
 	IRP   bool          // Inverse RXD Polarity - Set to inverse the RXD polarity
+	Port  Port          // The port to use instead of opening Name with go232
+
+	Observer go1wire.Observer // Told about resyncs if set
 
 	// Sanitized Configuration Values
 	speed byte
@@ -166,11 +198,14 @@ type Ds2480 struct {
 	irp   bool
 
 	// Runtime State about the chip
-	serial    *serial.Serial
-	chipLevel byte
-	chipBaud  byte
-	chipMode  byte
-	chipSpeed byte
+	mu          sync.Mutex
+	open        bool
+	ownPort     bool
+	chipVersion string
+	chipLevel   byte
+	chipBaud    byte
+	chipMode    byte
+	chipSpeed   byte
 }
 
 func checkStringConfig(name, cfg string, m map[string]byte) error {
@@ -228,7 +263,7 @@ func (d *Ds2480) Init() error {
 	if err := checkDurationConfig("SPUD", d.SPUD, spudMap); nil != err {
 		return err
 	}
-	d.spud = ppdMap[d.SPUD]
+	d.spud = spudMap[d.SPUD]
 
 	if err := checkDurationConfig("W1LT", d.W1LT, w1ltMap); nil != err {
 		return err
@@ -259,124 +294,462 @@ func (d *Ds2480) Init() error {
 }
 
 func (d *Ds2480) Open() error {
-	if nil != d.serial {
+	if d.open {
 		return ErrInvalidState
 	}
-	d.serial = &serial.Serial{Name: d.Name}
-	return d.serial.Open()
+	if nil == d.Port {
+		p, err := OpenSerial(d.Name)
+		if nil != err {
+			return err
+		}
+		d.Port = p
+		d.ownPort = true
+	}
+	d.open = true
+	return nil
 }
 
+// Close closes the port opened from Name so the next Open opens it again.  A
+// Port set by the caller belongs to the caller and is left open.
 func (d *Ds2480) Close() error {
-	if nil != d.serial {
-		return d.serial.Close()
+	d.open = false
+	if !d.ownPort {
+		return nil
+	}
+
+	d.ownPort = false
+	p := d.Port
+	d.Port = nil
+	if c, ok := p.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
 	}
 	return nil
 }
 
 func (d *Ds2480) Detect() (bool, error) {
+	return d.DetectContext(context.Background())
+}
+
+func (d *Ds2480) DetectContext(ctx context.Context) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.detect(ctx)
+}
+
+// detect configures the chip and switches to the configured baud rate.
+func (d *Ds2480) detect(ctx context.Context) (bool, error) {
+	ok, err := d.configure(ctx)
+	if !ok || nil != err || 0 == d.baudValue() {
+		return ok, err
+	}
+
+	if err := d.switchBaud(ctx); nil != err {
+		if nil != ctx.Err() {
+			return false, ctx.Err()
+		}
+
+		// The break returns the chip to 9600 baud.
+		return d.configure(ctx)
+	}
+
+	return true, nil
+}
+
+// configure resets the chip with a break, then sends and verifies every
+// configuration parameter at 9600 baud.
+func (d *Ds2480) configure(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); nil != err {
+		return false, err
+	}
+
 	d.chipMode = CHIP_MODE__COMMAND
 	d.chipBaud = baudMap[9600]
 	d.chipSpeed = speedMap["flexible"]
 
-	d.serial.Baud = 9600
-	d.serial.Config = "8N1"
-	if err := d.serial.UpdateCfg(); nil != err {
+	if err := d.Port.SetConfig(9600, "8N1"); nil != err {
 		return false, err
 	}
-	if err := d.serial.SendBreak(); nil != err {
+	if err := d.Port.SendBreak(); nil != err {
 		return false, err
 	}
 
-	time.Sleep(time.Millisecond * 2)
+	if err := sleep(ctx, time.Millisecond*2); nil != err {
+		return false, err
+	}
 
-	if err := d.serial.Flush(); nil != err {
+	if err := d.Port.Flush(); nil != err {
 		return false, err
 	}
 
 	reset := make([]byte, 1)
 	reset[0] = CMD_RESET | (d.speed << 2)
-	if n, err := d.serial.Write(reset); n != 1 || nil != err {
+	if n, err := d.Port.Write(reset); n != 1 || nil != err {
+		return false, err
+	}
+
+	if err := sleep(ctx, time.Millisecond*2); nil != err {
 		return false, err
 	}
 
-	time.Sleep(time.Millisecond * 2)
-	send := make([]byte, 5)
-	send[0] = CMD_CONFIG | (CFG_PDSRC << 4) | (d.pdsrc << 1)
-	send[1] = CMD_CONFIG | (CFG_W1LT << 4) | (d.w1lt << 1)
-	send[2] = CMD_CONFIG | (CFG_W0RT << 4) | (d.w0rt << 1)
-	send[3] = CMD_CONFIG | (CFG_READ << 4) | (CFG_BAUD << 1)
-	send[4] = CMD_WRITE_BIT | (1 << 4) | (d.speed << 2) | (d.spu << 1)
+	params := []struct {
+		param, value byte
+	}{
+		{CFG_PDSRC, d.pdsrc},
+		{CFG_PPD, d.ppd},
+		{CFG_SPUD, d.spud},
+		{CFG_W1LT, d.w1lt},
+		{CFG_W0RT, d.w0rt},
+		{CFG_LOAD, d.load},
+	}
+
+	// Write every parameter, then read each back, then check a bit.
+	var send []byte
+	for _, p := range params {
+		send = append(send, CMD_CONFIG|(p.param<<4)|(p.value<<1))
+	}
+	for _, p := range params {
+		send = append(send, CMD_CONFIG|(CFG_READ<<4)|(p.param<<1))
+	}
+	send = append(send, CMD_WRITE_BIT|(1<<4)|(d.speed<<2)|(d.spu<<1))
 
-	//fmt.Printf("Sending:\n%s", hex.Dump(send))
-	if n, err := d.serial.Write(send); len(send) != n || nil != err {
+	if n, err := d.Port.Write(send); len(send) != n || nil != err {
 		return false, err
 	}
 
-	got := make([]byte, 5)
-	if _, err := io.ReadFull(d.serial, got); nil != err {
+	got := make([]byte, len(send))
+	if err := d.readFull(ctx, got); nil != err {
 		return false, err
 	}
 
-	//fmt.Printf("Got:\n%s", hex.Dump(got))
+	for i, p := range params {
+		if (0xfe&send[i]) != got[i] || p.value<<1 != got[len(params)+i] {
+			return false, nil
+		}
+	}
 
-	if got[3] == d.baud && (got[4]&0xFC) == (send[4]&0xfc) {
-		return true, nil
+	last := len(send) - 1
+	if (0xfc & got[last]) != (0xfc & send[last]) {
+		return false, nil
 	}
 
-	return false, nil
+	// The bit was sent at the configured speed.
+	d.chipSpeed = d.speed
+	return true, nil
 }
 
-func (d *Ds2480) Reset() (version string, result byte, err error) {
+// switchBaud moves the chip and then the host to the configured baud rate.
+// The chip answers the change at the new rate, which the host can't hear
+// reliably, so the rate is verified by reading it back afterwards.
+func (d *Ds2480) switchBaud(ctx context.Context) error {
+	value := d.baudValue()
+	cmd := []byte{CMD_CONFIG | (CFG_BAUD << 4) | (value << 1)}
+	if n, err := d.Port.Write(cmd); 1 != n || nil != err {
+		if nil == err {
+			err = io.ErrShortWrite
+		}
+		return err
+	}
+
+	if err := sleep(ctx, time.Millisecond*5); nil != err {
+		return err
+	}
+
+	if err := d.Port.SetConfig(baudRates[d.baud], "8N1"); nil != err {
+		return err
+	}
+	if err := d.Port.Flush(); nil != err {
+		return err
+	}
+
+	verify := []byte{CMD_CONFIG | (CFG_READ << 4) | (CFG_BAUD << 1)}
+	if n, err := d.Port.Write(verify); 1 != n || nil != err {
+		if nil == err {
+			err = io.ErrShortWrite
+		}
+		return err
+	}
+
+	vctx, cancel := context.WithTimeout(ctx, baudTimeout)
+	defer cancel()
+
+	got := make([]byte, 1)
+	if err := d.readFull(vctx, got); nil != err {
+		return err
+	}
+	if value<<1 != got[0] {
+		return ErrInvalidResponse
+	}
+
+	d.chipBaud = d.baud
+	return nil
+}
+
+// baudValue provides the value of the baud configuration parameter, which
+// also holds the RXD polarity.
+func (d *Ds2480) baudValue() byte {
+	value := d.baud
+	if d.irp {
+		value |= 1 << 2
+	}
+	return value
+}
+
+// Version returns the version of the chip seen in the last reset.
+func (d *Ds2480) Version() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.chipVersion
+}
+
+func (d *Ds2480) Reset() (go1wire.PresenceResult, error) {
+	return d.ResetContext(context.Background())
+}
+
+func (d *Ds2480) ResetContext(ctx context.Context) (go1wire.PresenceResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
 	tx := []byte{CMD_RESET | (d.speed << 2)}
 	rx := make([]byte, 1)
 
-	err = d.txrx(CHIP_MODE__COMMAND, tx, rx)
+	err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, rx)
 	if nil != err {
-		return "", 0, err
+		return go1wire.PresenceNone, err
 	}
 
 	if 0xc != 0xc&rx[0] {
-		d.Detect()
-		return "", 0, ErrInvalidResponse
+		d.resync(ctx)
+		return go1wire.PresenceNone, ErrInvalidResponse
 	}
 
 	switch (0x1c & rx[0]) >> 2 {
 	case 2:
-		version = "ds2480"
+		d.chipVersion = "ds2480"
 	case 3:
-		version = "ds2480b"
+		d.chipVersion = "ds2480b"
+	default:
+		d.resync(ctx)
+		return go1wire.PresenceNone, ErrInvalidResponse
+	}
+
+	return presenceMap[0x3&rx[0]], nil
+}
+
+// bitCmd builds the single bit command for the specified value.
+func (d *Ds2480) bitCmd(bit bool) byte {
+	cmd := byte(CMD_WRITE_BIT | (d.speed << 2))
+	if bit {
+		cmd |= 1 << 4
+	}
+	return cmd
+}
+
+// bits performs one single bit command per entry in tx and returns the
+// values read back from the bus.
+func (d *Ds2480) bits(ctx context.Context, tx []byte) ([]bool, error) {
+	rx := make([]byte, len(tx))
+
+	if err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, rx); nil != err {
+		return nil, err
+	}
+
+	got := make([]bool, len(rx))
+	for i := range rx {
+		if (0xfc & tx[i]) != (0xfc & rx[i]) {
+			d.resync(ctx)
+			return nil, ErrInvalidResponse
+		}
+		got[i] = 0x03 == (0x03 & rx[i])
+	}
+
+	return got, nil
+}
+
+// TouchBit writes the bit to the bus and returns the value read back.
+func (d *Ds2480) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	got, err := d.bits(ctx, []byte{d.bitCmd(bit)})
+	if nil != err {
+		return false, err
+	}
+	return got[0], nil
+}
+
+// ReadBit generates a read time slot and returns the value read.
+func (d *Ds2480) ReadBit(ctx context.Context) (bool, error) {
+	return d.TouchBit(ctx, true)
+}
+
+// WriteBit writes the bit to the bus.
+func (d *Ds2480) WriteBit(ctx context.Context, bit bool) error {
+	_, err := d.TouchBit(ctx, bit)
+	return err
+}
+
+// SetSpeed changes the speed used on the bus.  The search accelerator control
+// command carries the speed without causing any activity on the bus, so it is
+// used to switch the chip over right away.
+func (d *Ds2480) SetSpeed(ctx context.Context, s go1wire.Speed) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	speed := speedMap[d.Speed]
+	if go1wire.SpeedOverdrive == s {
+		speed = speedMap["overdrive"]
+	} else if speedMap["overdrive"] == speed {
+		speed = speedMap["standard"]
+	}
+
+	tx := []byte{CMD_SEARCH_ACCEL_OFF | (speed << 2)}
+	if err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, nil); nil != err {
+		return err
+	}
+
+	d.speed = speed
+	d.chipSpeed = speed
+	return nil
+}
+
+// WriteBytePower writes the byte one bit at a time with the strong pull-up
+// armed on the last bit, holds the pull-up for the duration and then stops
+// the pulse.  The strong pull-up duration is set to forever while the pulse
+// is active and restored to the configured value afterwards.
+func (d *Ds2480) WriteBytePower(ctx context.Context, b byte, duration time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tx := []byte{CMD_CONFIG | (CFG_SPUD << 4) | (spudMap[time.Hour] << 1)}
+	for i := uint(0); i < 8; i++ {
+		cmd := d.bitCmd(0 != 1&(b>>i))
+		if 7 == i {
+			cmd |= 1 << 1
+		}
+		tx = append(tx, cmd)
+	}
+	rx := make([]byte, len(tx))
+
+	if err := d.txrx(ctx, CHIP_MODE__COMMAND, tx, rx); nil != err {
+		return err
+	}
+
+	var got byte
+	valid := (0xfe & tx[0]) == rx[0]
+	for i := 1; i < len(rx); i++ {
+		if (0xfc & tx[i]) != (0xfc & rx[i]) {
+			valid = false
+		}
+		if 0x03 == (0x03 & rx[i]) {
+			got |= 1 << uint(i-1)
+		}
+	}
+
+	// The pulse must always be stopped, so don't let the caller's context
+	// prevent that.
+	waitErr := sleep(ctx, duration)
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Stop the pulse, then disarm, which pulses again until stopped.  Each
+	// pulse is answered when it ends.
+	stop := []byte{MODE_STOP_PULSE, CMD_PULLUP_DISARM, MODE_STOP_PULSE}
+	resp := make([]byte, 2)
+	if err := d.txrx(stopCtx, CHIP_MODE__COMMAND, stop, resp); nil != err {
+		return err
+	}
+	for _, r := range resp {
+		if (0xfc & CMD_PULSE) != (0xfc & r) {
+			valid = false
+		}
+	}
+
+	// The pulse duration can only be restored once no pulse is running.
+	restore := []byte{CMD_CONFIG | (CFG_SPUD << 4) | (d.spud << 1)}
+	resp = resp[:1]
+	if err := d.txrx(stopCtx, CHIP_MODE__COMMAND, restore, resp); nil != err {
+		return err
+	}
+
+	if !valid || (0xfe&restore[0]) != resp[0] {
+		d.resync(stopCtx)
+		return ErrInvalidResponse
+	}
+
+	if nil != waitErr {
+		return waitErr
+	}
+
+	if b != got {
+		return ErrInvalidResponse
+	}
+
+	return nil
+}
+
+// Triplet reads the id and complement bits in a single exchange with the
+// chip, then writes the direction to take.
+func (d *Ds2480) Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	got, err := d.bits(ctx, []byte{d.bitCmd(true), d.bitCmd(true)})
+	if nil != err {
+		return false, false, false, err
+	}
+	id, cmp = got[0], got[1]
+
+	switch {
+	case id && cmp:
+		taken = true
+	case id != cmp:
+		taken = id
 	default:
-		d.Detect()
-		return "", 0, ErrInvalidResponse
+		taken = dir
 	}
 
-	result = 0x3 & rx[0]
+	if _, err = d.bits(ctx, []byte{d.bitCmd(taken)}); nil != err {
+		return false, false, false, err
+	}
 
-	return version, result, nil
+	return id, cmp, taken, nil
 }
 
-func searchToBytes(tree uint64, conflict int) []byte {
+// searchToBytes converts the path to follow into the search accelerator's
+// transmit format.  Bit i of path is the direction to take if there is a
+// discrepancy at bit i of the ROM.  Seeding the path with a family code (as
+// go1wire.Search.Target does) walks directly to that family.
+func searchToBytes(path uint64) []byte {
 	data := make([]byte, 16)
 
-	for i := uint(0); i < uint(conflict); i++ {
+	for i := uint(0); i < 64; i++ {
 		idx := i*2 + 1
 		byte_offset := idx / 8
 		bit_offset := idx - (8 * byte_offset)
 
-		data[byte_offset] |= byte(1&(tree>>i)) << bit_offset
+		data[byte_offset] |= byte(1&(path>>i)) << bit_offset
 	}
 
-	if conflict < 64 {
-		byte_offset := (conflict*2 + 1) / 8
-		bit_offset := (conflict*2 + 1) - (8 * byte_offset)
-		data[byte_offset] |= 1 << uint(bit_offset)
-	}
 	return data
 }
 
 func searchFromBytes(data []byte) (out uint64, conflict []int) {
-	//fmt.Printf("search data:\n%s", hex.Dump(data))
 	for i := uint(0); i < 64; i++ {
 		idx := i * 2
 		byte_offset := idx / 8
@@ -395,98 +768,167 @@ func searchFromBytes(data []byte) (out uint64, conflict []int) {
 	return out, conflict
 }
 
-func (d *Ds2480) thing(addr uint64, conflict int) ([]go1wire.Address, error) {
-	var list []go1wire.Address
-
-	this, conflicts, err := d.search(addr, conflict)
-	if nil != err {
-		return nil, err
-	}
+// Search returns the addresses of all the devices on the bus.
+func (d *Ds2480) Search() ([]go1wire.Address, error) {
+	return d.SearchContext(context.Background())
+}
 
-	a, err := go1wire.AddressFromSearch(this)
+func (d *Ds2480) SearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	return go1wire.NewSearch(d).All(ctx)
+}
 
-	if nil == err {
-		list = append(list, a)
-	}
+// AlarmSearch returns the addresses of the devices on the bus with their
+// alarm flag set.
+func (d *Ds2480) AlarmSearch() ([]go1wire.Address, error) {
+	return d.AlarmSearchContext(context.Background())
+}
 
-	for i := 0; i < len(conflicts); i++ {
-		got, err := d.thing(this, conflicts[i])
-		if nil == err {
-			list = append(list, got...)
-		}
-	}
-	return list, err
+func (d *Ds2480) AlarmSearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	return go1wire.NewAlarmSearch(d).All(ctx)
 }
 
-func (d *Ds2480) Search() ([]go1wire.Address, error) {
+// SearchFamily returns the addresses of the devices on the bus of the
+// family.
+func (d *Ds2480) SearchFamily(family byte) ([]go1wire.Address, error) {
+	return d.SearchFamilyContext(context.Background(), family)
+}
 
-	complete, err := d.thing(0, 0)
-	if nil != err {
-		return nil, err
-	}
+func (d *Ds2480) SearchFamilyContext(ctx context.Context, family byte) ([]go1wire.Address, error) {
+	return go1wire.NewSearch(d).Family(ctx, family)
+}
 
-	// Dedup the output
-	list := []go1wire.Address{}
-	tmp := make(map[go1wire.Address]int, 0)
-	for _, addr := range complete {
-		if _, val := tmp[addr]; !val {
-			tmp[addr] = 1
-			list = append(list, addr)
-		}
-	}
+// SearchExcept returns the addresses of the devices on the bus that are not
+// part of the listed families.
+func (d *Ds2480) SearchExcept(families ...byte) ([]go1wire.Address, error) {
+	return d.SearchExceptContext(context.Background(), families...)
+}
 
-	return list, nil
+func (d *Ds2480) SearchExceptContext(ctx context.Context, families ...byte) ([]go1wire.Address, error) {
+	return go1wire.NewSearch(d).Except(ctx, families...)
 }
 
-// Takes the uint64 that describes the tree to explore with the last byte
-// indicating the MSB to explore from
-//
-// Note: The uint64 that is returned is reversed endian to how the addresses
-//       are defined and used everywhere else.
+// SearchPass performs a single pass of the search using the chip's search
+// accelerator.  The bus must already have been reset.  cmd is sent before the
+// accelerator is enabled so both the normal and conditional search work.
 //
-// Returns the discovered tree and the index of the LSB conflict (or 64 if none)
-func (d *Ds2480) search(tree uint64, last int) (uint64, []int, error) {
-
-	if _, _, err := d.Reset(); nil != err {
-		return 0, nil, err
-	}
+// Note: The uint64 values are reversed endian to how the addresses are
+// defined and used everywhere else.
+func (d *Ds2480) SearchPass(ctx context.Context, cmd byte, path uint64) (uint64, []int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
 	preamble := []byte{
-		CMD_SEARCH,
+		cmd,
 		MODE_COMMAND, CMD_SEARCH_ACCEL_ON | (d.speed << 2),
 		MODE_DATA}
 
-	suffix := []byte{MODE_COMMAND, CMD_SEARCH_ACCEL_OFF}
+	// Turning the accelerator off also sets the speed, so keep it.
+	suffix := []byte{MODE_COMMAND, CMD_SEARCH_ACCEL_OFF | (d.speed << 2)}
 
-	data := searchToBytes(tree, last)
+	// Only the odd bits are set so the data never needs to be escaped.
+	data := searchToBytes(path)
 
 	tx := append(preamble, data...)
 	tx = append(tx, suffix...)
 
 	rx := make([]byte, 17)
-	//fmt.Printf("tx:\n%s", hex.Dump(tx))
-	err := d.txrx(MODE_DATA, tx, rx)
+	err := d.txrx(ctx, CHIP_MODE__DATA, tx, rx)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	if CMD_SEARCH != CMD_SEARCH&rx[0] {
-		d.Detect()
+	// The suffix leaves the chip in command mode.
+	d.chipMode = CHIP_MODE__COMMAND
+
+	if cmd != rx[0] {
+		d.resync(ctx)
 		return 0, nil, ErrInvalidResponse
 	}
 
-	//fmt.Printf("rx:\n%s", hex.Dump(rx))
 	rx = rx[1:]
 	out, conflicts := searchFromBytes(rx)
 
 	return out, conflicts, nil
 }
 
+// resync detects the chip again after an invalid response so the following
+// operations start from a known state.
+func (d *Ds2480) resync(ctx context.Context) {
+	if nil != d.Observer {
+		d.Observer.Resync()
+	}
+	d.detect(ctx)
+}
+
 func (d *Ds2480) TxRx(tx, rx []byte) error {
-	return d.txrx(MODE_DATA, tx, rx)
+	return d.TxRxContext(context.Background(), tx, rx)
+}
+
+// TxRxContext sends tx on the bus while filling rx with the bytes read back.
+// Any 0xe3 in tx is escaped so the chip stays in data mode; the chip still
+// answers with a single byte for it.
+func (d *Ds2480) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Every byte sent is answered, so read them all even if rx is short.
+	resp := rx
+	if len(rx) < len(tx) {
+		resp = make([]byte, len(tx))
+	}
+
+	if err := d.txrx(ctx, CHIP_MODE__DATA, escape(tx), resp[:len(tx)]); nil != err {
+		return err
+	}
+
+	copy(rx, resp)
+	return nil
+}
+
+// escape doubles every 0xe3 in data sent in data mode, where a single 0xe3
+// switches the chip to command mode.
+func escape(tx []byte) []byte {
+	n := bytes.Count(tx, []byte{MODE_COMMAND})
+	if 0 == n {
+		return tx
+	}
+
+	rv := make([]byte, 0, len(tx)+n)
+	for _, b := range tx {
+		rv = append(rv, b)
+		if MODE_COMMAND == b {
+			rv = append(rv, b)
+		}
+	}
+	return rv
+}
+
+// readFull reads exactly len(buf) bytes from the port.  Each read is given
+// a deadline of readPoll so the context can be checked while waiting.
+func (d *Ds2480) readFull(ctx context.Context, buf []byte) error {
+	for got := 0; got < len(buf); {
+		if err := d.Port.SetDeadline(time.Now().Add(readPoll)); nil != err {
+			return err
+		}
+		n, err := d.Port.Read(buf[got:])
+		got += n
+		if nil != err && !isTimeout(err) {
+			return err
+		}
+		if 0 == n {
+			if err := ctx.Err(); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-func (d *Ds2480) txrx(mode byte, tx, rx []byte) error {
+func (d *Ds2480) txrx(ctx context.Context, mode byte, tx, rx []byte) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
 	// Prepend the mode select byte
 	if mode != d.chipMode {
 		tmp := make([]byte, 1)
@@ -498,21 +940,24 @@ func (d *Ds2480) txrx(mode byte, tx, rx []byte) error {
 		tx = append(tmp, tx...)
 	}
 
-	if err := d.serial.Flush(); nil != err {
+	if err := d.Port.Flush(); nil != err {
 		return err
 	}
 
-	//fmt.Printf("Sending:\n%s", hex.Dump(tx))
-	if n, err := d.serial.Write(tx); len(tx) != n || nil != err {
+	if n, err := d.Port.Write(tx); len(tx) != n || nil != err {
+		if nil == err {
+			err = io.ErrShortWrite
+		}
 		return err
 	}
 
-	if _, err := io.ReadFull(d.serial, rx); nil != err {
-		d.Detect()
+	if err := d.readFull(ctx, rx); nil != err {
+		// The chip can't be resynchronized without more time.
+		if nil == ctx.Err() {
+			d.resync(ctx)
+		}
 		return err
 	}
 
-	//fmt.Printf("Got:\n%s", hex.Dump(rx))
-
 	return nil
 }
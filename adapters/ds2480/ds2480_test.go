@@ -1,24 +1,55 @@
 package ds2480
 
 import (
+	"context"
+	"io"
 	"testing"
+	"time"
 
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/ds2480/emulator"
+	"github.com/schmidtw/go1wire/adapters/sim"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// newEmulated creates an adapter talking to an emulated chip on a simulated
+// bus with the devices attached.
+func newEmulated(t *testing.T, devices ...*sim.Device) (*Ds2480, *emulator.Emulator, *sim.Bus) {
+	b := sim.NewBus(devices...)
+	e := emulator.New(b)
+	d := &Ds2480{
+		Speed: "standard",
+		PDSRC: 1370,
+		W1LT:  time.Microsecond * 10,
+		W0RT:  time.Microsecond * 8,
+	}
+	require.NoError(t, d.Init())
+	d.Port = e
+	return d, e, b
+}
+
+func mustParse(t *testing.T, list ...string) []go1wire.Address {
+	var rv []go1wire.Address
+	for _, s := range list {
+		a, err := go1wire.ParseAddress(s)
+		require.NoError(t, err)
+		rv = append(rv, a)
+	}
+	return rv
+}
+
 func TestSearchToFromBytes(t *testing.T) {
 
 	type TestVector struct {
 		Tree uint64
-		Last int
 		Data []byte
 	}
 
 	tests := []TestVector{
-		{Tree: 0x01, Last: 0, Data: []byte{0x3}},
-		{Tree: 0x01, Last: 1, Data: []byte{0x6}},
-		{Tree: 0x01, Last: 64, Data: []byte{0x2}},
-		{Tree: 0x01, Last: 63, Data: []byte{0x2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x40}},
+		{Tree: 0x01, Data: []byte{0x2}},
+		{Tree: 0x02, Data: []byte{0x8}},
+		{Tree: 0x8000000000000001, Data: []byte{0x2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80}},
 	}
 
 	assert := assert.New(t)
@@ -28,11 +59,498 @@ func TestSearchToFromBytes(t *testing.T) {
 		for i, _ := range test.Data {
 			expect[i] = test.Data[i]
 		}
-		got := searchToBytes(test.Tree, test.Last)
+		got := searchToBytes(test.Tree)
 		assert.Equal(expect, got)
 
-		out, last := searchFromBytes(expect)
+		out, conflicts := searchFromBytes(expect)
 		assert.Equal(test.Tree, out)
-		assert.Equal(test.Last, last)
+		assert.Empty(conflicts)
+	}
+}
+
+func TestSearchFromBytesConflicts(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 16)
+	data[0] = 0x01 | 0x04 | 0x08 // bit 0: conflict took 0, bit 1: conflict took 1
+	data[15] = 0x40              // bit 63: conflict took 0
+
+	out, conflicts := searchFromBytes(data)
+	assert.Equal(uint64(0x02), out)
+	assert.Equal([]int{0, 63}, conflicts)
+}
+
+func TestDetect(t *testing.T) {
+	assert := assert.New(t)
+
+	d, e, _ := newEmulated(t)
+
+	ok, err := d.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+
+	assert.Equal(byte(3), e.Config(CFG_PDSRC))
+	assert.Equal(byte(2), e.Config(CFG_W1LT))
+	assert.Equal(byte(5), e.Config(CFG_W0RT))
+	assert.True(e.CommandMode())
+	assert.Equal(9600, e.Baud())
+}
+
+func TestDetectAllParams(t *testing.T) {
+	assert := assert.New(t)
+
+	d, e, _ := newEmulated(t)
+	d.PPD = time.Microsecond * 1024
+	d.SPUD = time.Millisecond * 1048
+	d.LOAD = 3000
+	require.NoError(t, d.Init())
+
+	ok, err := d.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+
+	assert.Equal(byte(3), e.Config(CFG_PDSRC))
+	assert.Equal(byte(5), e.Config(CFG_PPD))
+	assert.Equal(byte(5), e.Config(CFG_SPUD))
+	assert.Equal(byte(2), e.Config(CFG_W1LT))
+	assert.Equal(byte(5), e.Config(CFG_W0RT))
+	assert.Equal(byte(4), e.Config(CFG_LOAD))
+}
+
+// baudPort loses the baud rate changes sent to the chip when set.
+type baudPort struct {
+	Port
+	lose  bool
+	bauds []int
+}
+
+func (b *baudPort) Write(p []byte) (int, error) {
+	if b.lose && 1 == len(p) && (CMD_CONFIG|(CFG_BAUD<<4)) == 0xf1&p[0] {
+		return 1, nil
+	}
+	return b.Port.Write(p)
+}
+
+func (b *baudPort) SetConfig(baud int, framing string) error {
+	b.bauds = append(b.bauds, baud)
+	return b.Port.SetConfig(baud, framing)
+}
+
+func TestDetectBaud(t *testing.T) {
+	assert := assert.New(t)
+
+	roms := mustParse(t, "28.000000000001.--")
+	d, e, _ := newEmulated(t, sim.NewDevice(roms[0], nil))
+	p := &baudPort{Port: e}
+	d.Port = p
+	d.Baud = 115200
+	require.NoError(t, d.Init())
+
+	ok, err := d.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(115200, e.Baud())
+	assert.Equal([]int{9600, 115200}, p.bauds)
+
+	// Everything works at the new rate
+	got, err := d.Search()
+	assert.NoError(err)
+	assert.Equal(roms, got)
+
+	// The chip doesn't change so both fall back to 9600
+	p.lose = true
+	p.bauds = nil
+	ok, err = d.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(9600, e.Baud())
+	assert.Equal([]int{9600, 115200, 9600}, p.bauds)
+
+	presence, err := d.Reset()
+	assert.NoError(err)
+	assert.Equal(go1wire.PresenceDetected, presence)
+}
+
+func TestReset(t *testing.T) {
+	assert := assert.New(t)
+
+	roms := mustParse(t, "28.000000000001.--")
+	d, _, b := newEmulated(t)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	p, err := d.Reset()
+	assert.NoError(err)
+	assert.Equal(go1wire.PresenceNone, p)
+	assert.Equal("ds2480b", d.Version())
+
+	b.Attach(sim.NewDevice(roms[0], nil))
+	p, err = d.Reset()
+	assert.NoError(err)
+	assert.Equal(go1wire.PresenceDetected, p)
+}
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"10.450736030800.--",
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"28.800000000002.--",
+		"01.4507360308ff.--",
+	)
+
+	hot := sim.NewDS18B20(roms[1])
+	hot.SetTemp(80)
+	devices := []*sim.Device{hot.Device}
+	for i, a := range roms {
+		if 1 != i {
+			devices = append(devices, sim.NewDevice(a, nil))
+		}
+	}
+
+	d, e, _ := newEmulated(t, devices...)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	got, err := d.Search()
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms, got)
+	}
+	assert.True(e.CommandMode())
+
+	got, err = d.SearchFamily(0x28)
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms[1:4], got)
+	}
+
+	got, err = d.SearchExcept(0x28)
+	if assert.NoError(err) {
+		assert.ElementsMatch([]go1wire.Address{roms[0], roms[4]}, got)
+	}
+
+	// Convert so the hot device alarms
+	bus := go1wire.NewBus(d)
+	assert.NoError(bus.SkipROM(ctx))
+	assert.NoError(bus.Write(ctx, []byte{0x44}))
+	got, err = d.AlarmSearch()
+	if assert.NoError(err) {
+		assert.Equal(roms[1:2], got)
+	}
+}
+
+func TestModes(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t, "28.000000000001.--")
+	therm := sim.NewDS18B20(roms[0])
+	d, e, _ := newEmulated(t, therm.Device)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	bus := go1wire.NewBus(d)
+
+	// Reset in command mode, ROM & function in data mode
+	rx := make([]byte, 10)
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(bus.TxRx(ctx, []byte{0xbe,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, rx))
+	assert.False(e.CommandMode())
+	assert.Equal(therm.ScratchPad(), rx[1:])
+
+	// Back to command mode for the bits
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(bus.Write(ctx, []byte{0xb4}))
+	bit, err := d.ReadBit(ctx)
+	assert.NoError(err)
+	assert.True(bit)
+	assert.True(e.CommandMode())
+
+	therm.SetParasite(true)
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(bus.Write(ctx, []byte{0xb4}))
+	bit, err = d.ReadBit(ctx)
+	assert.NoError(err)
+	assert.False(bit)
+
+	a, err := bus.ReadROM(ctx)
+	if assert.NoError(err) {
+		assert.Equal(roms[0], a)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]byte{0x01, 0x02}, escape([]byte{0x01, 0x02}))
+	assert.Equal([]byte{0xe3, 0xe3, 0x01, 0xe3, 0xe3}, escape([]byte{0xe3, 0x01, 0xe3}))
+	assert.Empty(escape(nil))
+}
+
+func TestTxRxEscaped(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t, "28.000000000001.--")
+	therm := sim.NewDS18B20(roms[0])
+	d, e, _ := newEmulated(t, therm.Device)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	bus := go1wire.NewBus(d)
+
+	// TH & TL of 0xe3 must reach the device without leaving data mode
+	tx := []byte{0x4e, 0xe3, 0xe3, 0x7f}
+	rx := make([]byte, len(tx))
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(bus.TxRx(ctx, tx, rx))
+	assert.Equal(tx, rx)
+	assert.False(e.CommandMode())
+	assert.Equal([]byte{0xe3, 0xe3, 0x7f}, therm.ScratchPad()[2:5])
+
+	// A short rx still consumes every response
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(d.TxRx([]byte{0x4e, 0xe3, 0x00, 0x7f}, nil))
+	assert.Equal([]byte{0xe3, 0x00, 0x7f}, therm.ScratchPad()[2:5])
+
+	a, err := bus.ReadROM(ctx)
+	if assert.NoError(err) {
+		assert.Equal(roms[0], a)
+	}
+}
+
+func TestTriplet(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"29.000000000001.--",
+	)
+	d, _, _ := newEmulated(t, sim.NewDevice(roms[0], nil), sim.NewDevice(roms[1], nil))
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	// Family 0x28 & 0x29 only differ in bit 0
+	_, err = d.Reset()
+	assert.NoError(err)
+	assert.NoError(d.TxRx([]byte{go1wire.ROM_SEARCH}, make([]byte, 1)))
+
+	id, cmp, taken, err := d.Triplet(ctx, true)
+	assert.NoError(err)
+	assert.False(id)
+	assert.False(cmp)
+	assert.True(taken)
+
+	for i := 1; i < 8; i++ {
+		id, cmp, taken, err = d.Triplet(ctx, false)
+		assert.NoError(err)
+		assert.NotEqual(id, cmp)
+		assert.Equal(id, taken)
+	}
+}
+
+func TestSetSpeed(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t, "2d.000000000001.--")
+	dev := sim.NewDevice(roms[0], nil)
+	dev.Overdrive = true
+	d, e, _ := newEmulated(t, dev)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	bus := go1wire.NewBus(d)
+	assert.NoError(bus.OverdriveSkipROM(ctx))
+	assert.Equal(byte(emulator.SpeedOverdrive), e.Speed())
+	assert.NoError(bus.Reset(ctx))
+
+	a, err := bus.ReadROM(ctx)
+	if assert.NoError(err) {
+		assert.Equal(roms[0], a)
+	}
+
+	// The search accelerator keeps to overdrive
+	list, err := bus.Search(ctx)
+	if assert.NoError(err) {
+		assert.Equal(roms, list)
+	}
+	assert.Equal(byte(emulator.SpeedOverdrive), e.Speed())
+	a, err = bus.ReadROM(ctx)
+	if assert.NoError(err) {
+		assert.Equal(roms[0], a)
+	}
+
+	assert.NoError(bus.Standard(ctx))
+	assert.Equal(byte(emulator.SpeedStandard), e.Speed())
+}
+
+func TestWriteBytePower(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t, "28.000000000001.--")
+	therm := sim.NewDS18B20(roms[0])
+	therm.SetParasite(true)
+	therm.SetTemp(22.5)
+
+	d, e, _ := newEmulated(t, therm.Device)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	bus := go1wire.NewBus(d)
+
+	// 9-bit resolution only needs 93.75ms
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(bus.Write(ctx, []byte{0x4e, 0x4b, 0x46, 0x1f}))
+
+	err = bus.Do(ctx, func(tx *go1wire.Tx) error {
+		if err := tx.MatchROM(roms[0]); nil != err {
+			return err
+		}
+		return tx.WriteBytePower(0x44, time.Millisecond*100)
+	})
+	assert.NoError(err)
+	assert.Equal([]byte{0x6f, 0x01}, therm.ScratchPad()[:2])
+
+	// The configured pull-up duration is restored
+	assert.Equal(d.spud, e.Config(CFG_SPUD))
+
+	// Nothing is left over from stopping the pulse to confuse what follows
+	rx := make([]byte, 10)
+	assert.NoError(bus.MatchROM(ctx, roms[0]))
+	assert.NoError(bus.TxRx(ctx, []byte{0xbe,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, rx))
+	assert.Equal(therm.ScratchPad(), rx[1:])
+	assert.NoError(e.SetDeadline(time.Now().Add(time.Millisecond)))
+	n, _ := e.Read(make([]byte, 1))
+	assert.Equal(0, n)
+}
+
+func TestReadTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	d, e, _ := newEmulated(t)
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	// The chip can't hear the host so nothing comes back
+	assert.NoError(e.SetConfig(19200, "8N1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*250)
+	defer cancel()
+	_, err = d.ResetContext(ctx)
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+// shortPort drops the last byte of the next write without an error when
+// armed.
+type shortPort struct {
+	Port
+	armed bool
+}
+
+func (s *shortPort) Write(p []byte) (int, error) {
+	if s.armed && 0 < len(p) {
+		s.armed = false
+		return s.Port.Write(p[:len(p)-1])
+	}
+	return s.Port.Write(p)
+}
+
+func TestShortWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	d, e, _ := newEmulated(t)
+	s := &shortPort{Port: e}
+	d.Port = s
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	s.armed = true
+	_, err = d.Reset()
+	assert.Equal(io.ErrShortWrite, err)
+}
+
+// garbledPort corrupts the next byte read when armed.
+type garbledPort struct {
+	Port
+	armed bool
+}
+
+func (g *garbledPort) Read(buf []byte) (int, error) {
+	n, err := g.Port.Read(buf)
+	if g.armed && 0 < n {
+		buf[0] &^= 0x0c
+		g.armed = false
 	}
+	return n, err
+}
+
+type countingObserver struct {
+	resyncs int
+}
+
+func (c *countingObserver) CRCError(a go1wire.Address) {}
+func (c *countingObserver) Resync()                    { c.resyncs++ }
+
+func TestResync(t *testing.T) {
+	assert := assert.New(t)
+
+	d, e, _ := newEmulated(t)
+	g := &garbledPort{Port: e}
+	o := &countingObserver{}
+	d.Port = g
+	d.Observer = o
+	_, err := d.Detect()
+	require.NoError(t, err)
+
+	g.armed = true
+	_, err = d.Reset()
+	assert.Equal(ErrInvalidResponse, err)
+	assert.Equal(1, o.resyncs)
+
+	// The chip is usable again
+	p, err := d.Reset()
+	assert.NoError(err)
+	assert.Equal(go1wire.PresenceNone, p)
+	assert.Equal(1, o.resyncs)
+}
+
+// closingPort is a port that records being closed.
+type closingPort struct {
+	Port
+	closed bool
+}
+
+func (c *closingPort) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestOpenClose(t *testing.T) {
+	assert := assert.New(t)
+
+	// A port set by the caller stays open so it can be used again
+	_, e, _ := newEmulated(t)
+	p := &closingPort{Port: e}
+	d := &Ds2480{Port: p}
+	assert.NoError(d.Open())
+	assert.Equal(ErrInvalidState, d.Open())
+	assert.NoError(d.Close())
+	assert.False(p.closed)
+	assert.NoError(d.Open())
+	assert.NoError(d.Close())
+
+	// A port opened from the name is closed and forgotten
+	p = &closingPort{Port: e}
+	d = &Ds2480{Name: "/dev/does-not-exist", Port: p, ownPort: true, open: true}
+	assert.NoError(d.Close())
+	assert.True(p.closed)
+	assert.Nil(d.Port)
+	assert.Error(d.Open())
 }
@@ -0,0 +1,445 @@
+// Package emulator provides an in-process DS2480B attached to a simulated
+// bus so the ds2480 adapter can be tested without hardware.
+//
+// The emulator follows the command and data mode protocol described in
+// DS2480B.pdf: the calibration byte after a break, configuration reads and
+// writes, resets, single bits, the search accelerator, strong pull-up pulses
+// and the escaping of 0xe3 in data mode.
+package emulator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/sim"
+)
+
+// The configuration parameter codes - defined in DS2480B.pdf page 13
+const (
+	ParamPDSRC = 1
+	ParamPPD   = 2
+	ParamSPUD  = 3
+	ParamW1LT  = 4
+	ParamW0RT  = 5
+	ParamLOAD  = 6
+	ParamBaud  = 7
+)
+
+// The speed codes used in the reset, bit and search accelerator commands.
+const (
+	SpeedStandard  = 0
+	SpeedFlexible  = 1
+	SpeedOverdrive = 2
+)
+
+const (
+	modeData    = 0xe1
+	modeCommand = 0xe3
+	stopPulse   = 0xf1
+
+	// The response when the strong pull-up after a bit or byte ends: a
+	// pulse response for a 5V strong pull-up.
+	pulseResponse = 0xec
+
+	// The strong pull-up duration value meaning until stopped.
+	spudForever = 7
+)
+
+// The default configuration values after power up or a break.
+var defaults = [8]byte{
+	ParamPPD:  4,
+	ParamSPUD: 4,
+}
+
+// The baud rates selected by the low 2 bits of the baud configuration.
+var bauds = [4]int{9600, 19200, 57600, 115200}
+
+// Strong pull-up durations - defined in DS2480B.pdf page 13
+var spuds = [8]time.Duration{
+	time.Microsecond * 16400,
+	time.Microsecond * 65500,
+	time.Millisecond * 131,
+	time.Millisecond * 262,
+	time.Millisecond * 524,
+	time.Millisecond * 1048,
+	time.Millisecond * 1048,
+}
+
+// An Emulator is a DS2480B attached to a simulated bus.
+type Emulator struct {
+	mu  sync.Mutex
+	bus *sim.Bus
+
+	// What the host side of the serial line is set to.
+	hostBaud int
+
+	calibrated bool
+	command    bool
+	escape     bool
+	accel      bool
+	speed      byte
+	config     [8]byte
+	search     []byte
+	armed      bool
+	pulse      time.Time
+	pulsing    bool
+	pulseResp  byte
+
+	rx       []byte
+	ready    chan struct{}
+	deadline time.Time
+}
+
+// New creates an Emulator attached to the bus.  The emulator starts in the
+// power up state.
+func New(bus *sim.Bus) *Emulator {
+	e := &Emulator{
+		bus:      bus,
+		hostBaud: 9600,
+		ready:    make(chan struct{}),
+	}
+	e.powerUp()
+	return e
+}
+
+// Config returns the value of the configuration parameter.
+func (e *Emulator) Config(param byte) byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.config[0x07&param]
+}
+
+// Speed returns the speed code last used.
+func (e *Emulator) Speed() byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.speed
+}
+
+// CommandMode returns true if the emulator is in command mode.
+func (e *Emulator) CommandMode() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.command
+}
+
+// Baud returns the baud rate the chip is using.
+func (e *Emulator) Baud() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.baud()
+}
+
+// Read returns the responses from the chip.  If there are none it waits for
+// them until the deadline passes.
+func (e *Emulator) Read(p []byte) (int, error) {
+	for {
+		e.mu.Lock()
+		n := copy(p, e.rx)
+		e.rx = e.rx[n:]
+		deadline, ready := e.deadline, e.ready
+		e.mu.Unlock()
+
+		if 0 < n || 0 == len(p) {
+			return n, nil
+		}
+
+		if deadline.IsZero() {
+			<-ready
+			continue
+		}
+
+		t := time.NewTimer(time.Until(deadline))
+		select {
+		case <-ready:
+			t.Stop()
+		case <-t.C:
+			return 0, go1wire.TimeoutError{}
+		}
+	}
+}
+
+// SetDeadline sets the time after which Read gives up waiting.  The zero
+// value means Read waits forever.
+func (e *Emulator) SetDeadline(t time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.deadline = t
+	return nil
+}
+
+// Write sends the bytes to the chip, which processes them right away.  If
+// the host and chip baud rates do not match the bytes are lost.
+func (e *Emulator) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.hostBaud != e.baud() {
+		return len(p), nil
+	}
+
+	for _, b := range p {
+		e.process(b)
+	}
+	return len(p), nil
+}
+
+// Flush discards any responses that have not been read.
+func (e *Emulator) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rx = nil
+	return nil
+}
+
+// SendBreak returns the chip to the power up state.
+func (e *Emulator) SendBreak() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.powerUp()
+	return nil
+}
+
+// SetConfig sets the host side of the serial line.  Only the baud rate is
+// used.
+func (e *Emulator) SetConfig(baud int, framing string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.hostBaud = baud
+	return nil
+}
+
+func (e *Emulator) powerUp() {
+	e.calibrated = false
+	e.command = true
+	e.escape = false
+	e.accel = false
+	e.speed = SpeedStandard
+	e.config = defaults
+	e.search = nil
+	e.armed = false
+	e.pulsing = false
+	e.rx = nil
+	e.bus.SetSpeed(context.Background(), go1wire.SpeedStandard)
+}
+
+func (e *Emulator) baud() int {
+	return bauds[0x03&e.config[ParamBaud]]
+}
+
+// respond queues a response byte for the host.  The response is lost if the
+// host is not using the same baud rate as the chip.
+func (e *Emulator) respond(b byte) {
+	if e.hostBaud == e.baud() {
+		e.rx = append(e.rx, b)
+		close(e.ready)
+		e.ready = make(chan struct{})
+	}
+}
+
+func (e *Emulator) process(b byte) {
+	// The first byte after power up is only used to calibrate the timing.
+	if !e.calibrated {
+		e.calibrated = true
+		return
+	}
+
+	// Only stopping the pulse is heard until it ends.
+	if e.pulsing {
+		if stopPulse == b {
+			e.endPulse()
+		}
+		return
+	}
+
+	if e.command {
+		e.commandByte(b)
+		return
+	}
+
+	if e.escape {
+		e.escape = false
+		if modeCommand != b {
+			e.command = true
+			e.commandByte(b)
+			return
+		}
+	} else if modeCommand == b {
+		e.escape = true
+		return
+	}
+
+	e.dataByte(b)
+}
+
+func (e *Emulator) commandByte(b byte) {
+	switch {
+	case modeData == b:
+		e.command = false
+
+	case modeCommand == b:
+
+	case stopPulse == b:
+		// There is no pulse to stop.
+
+	case 0 == 0x80&b:
+		e.configByte(b)
+
+	case 0xc1 == 0xe3&b:
+		e.setSpeed(0x03 & (b >> 2))
+		p, _ := e.bus.Reset()
+		e.respond(0xcc | presence(p))
+
+	case 0x81 == 0xe1&b:
+		e.setSpeed(0x03 & (b >> 2))
+		got, _ := e.bus.TouchBit(context.Background(), 0 != 0x10&b)
+		rv := 0xfc & b
+		if got {
+			rv |= 0x03
+		}
+		e.respond(rv)
+		if 0 != 0x02&b {
+			e.startPulse(pulseResponse)
+		}
+
+	case 0xa1 == 0xe3&b:
+		e.setSpeed(0x03 & (b >> 2))
+		e.accel = 0 != 0x10&b
+		e.search = nil
+
+	case 0xed == 0xed&b:
+		// Pulse command, arming or disarming the strong pull-up after
+		// every byte in data mode, then pulsing.
+		e.armed = 0 != 0x02&b
+		e.startPulse(0xfc & b)
+	}
+}
+
+func (e *Emulator) configByte(b byte) {
+	param := 0x07 & (b >> 4)
+	value := 0x07 & (b >> 1)
+
+	if 0 == param {
+		e.respond(e.config[value] << 1)
+		return
+	}
+
+	// A new baud rate applies to the response.
+	e.config[param] = value
+	e.respond(0xfe & b)
+}
+
+func (e *Emulator) dataByte(b byte) {
+	if !e.accel {
+		var rv byte
+		for i := uint(0); i < 8; i++ {
+			got, _ := e.bus.TouchBit(context.Background(), 0 != 1&(b>>i))
+			if got {
+				rv |= 1 << i
+			}
+		}
+		e.respond(rv)
+		if e.armed {
+			e.startPulse(pulseResponse)
+		}
+		return
+	}
+
+	e.search = append(e.search, b)
+	if 16 == len(e.search) {
+		for _, r := range e.searchPass(e.search) {
+			e.respond(r)
+		}
+		e.search = nil
+	}
+}
+
+// searchPass walks the 64 bits of the search taking the direction in the
+// odd bits of tx when there is a discrepancy.  The response holds the
+// discrepancy flag in the even bits and the direction taken in the odd
+// bits.
+func (e *Emulator) searchPass(tx []byte) []byte {
+	ctx := context.Background()
+	rx := make([]byte, 16)
+
+	for i := uint(0); i < 64; i++ {
+		idx := i*2 + 1
+		dir := 0 != 1&(tx[idx/8]>>(idx%8))
+
+		id, _ := e.bus.ReadBit(ctx)
+		cmp, _ := e.bus.ReadBit(ctx)
+
+		var conflict, taken bool
+		switch {
+		case id && cmp:
+			conflict, taken = true, true
+		case id != cmp:
+			taken = id
+		default:
+			conflict, taken = true, dir
+		}
+		e.bus.WriteBit(ctx, taken)
+
+		if conflict {
+			rx[(idx-1)/8] |= 1 << ((idx - 1) % 8)
+		}
+		if taken {
+			rx[idx/8] |= 1 << (idx % 8)
+		}
+	}
+
+	return rx
+}
+
+func (e *Emulator) setSpeed(speed byte) {
+	e.speed = speed
+	s := go1wire.SpeedStandard
+	if SpeedOverdrive == speed {
+		s = go1wire.SpeedOverdrive
+	}
+	e.bus.SetSpeed(context.Background(), s)
+}
+
+// startPulse applies the strong pull-up for the configured duration.  The
+// response is given when the pulse ends.
+func (e *Emulator) startPulse(resp byte) {
+	spud := e.config[ParamSPUD]
+	if spudForever != spud {
+		e.bus.StrongPullUp(spuds[spud])
+		e.respond(resp)
+		return
+	}
+	e.pulsing = true
+	e.pulse = time.Now()
+	e.pulseResp = resp
+}
+
+func (e *Emulator) endPulse() {
+	e.pulsing = false
+	e.bus.StrongPullUp(time.Since(e.pulse))
+	e.respond(e.pulseResp)
+}
+
+// presence converts the result of a reset to the bits of the reset response.
+// The version bits always report a DS2480B.
+func presence(p go1wire.PresenceResult) byte {
+	switch p {
+	case go1wire.PresenceShorted:
+		return 0
+	case go1wire.PresenceDetected:
+		return 1
+	case go1wire.PresenceAlarming:
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,130 @@
+package emulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a Function that records the bytes written.
+type recorder struct {
+	in []byte
+}
+
+func (r *recorder) Reset()    { r.in = nil }
+func (r *recorder) Out() byte { return 0xff }
+func (r *recorder) In(b byte) { r.in = append(r.in, b) }
+
+// exchange writes tx and returns everything the emulator responded with.
+func exchange(e *Emulator, tx ...byte) []byte {
+	e.Write(tx)
+	e.SetDeadline(time.Now().Add(time.Millisecond * 10))
+	rx := make([]byte, 64)
+	n, _ := e.Read(rx)
+	return rx[:n]
+}
+
+func TestConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	e := New(sim.NewBus())
+
+	// The calibration byte gets no response
+	assert.Empty(exchange(e, 0xc1))
+
+	// Write PDSRC 3 then read it back along with the default SPUD
+	assert.Equal([]byte{0x16, 0x06, 0x08}, exchange(e, 0x17, 0x03, 0x07))
+	assert.Equal(byte(3), e.Config(ParamPDSRC))
+
+	// A break restores the defaults
+	assert.NoError(e.SendBreak())
+	assert.Empty(exchange(e, 0xc1))
+	assert.Equal(byte(0), e.Config(ParamPDSRC))
+}
+
+func TestReset(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := go1wire.ParseAddress("28.000000000001.--")
+	b := sim.NewBus()
+	e := New(b)
+	exchange(e, 0xc1)
+
+	assert.Equal([]byte{0xcf}, exchange(e, 0xc1))
+	b.Attach(sim.NewDevice(a, nil))
+	assert.Equal([]byte{0xcd}, exchange(e, 0xc1))
+
+	// Overdrive speed
+	assert.Equal([]byte{0xcf}, exchange(e, 0xc9))
+	assert.Equal(byte(SpeedOverdrive), e.Speed())
+}
+
+func TestEscape(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := go1wire.ParseAddress("28.000000000001.--")
+	r := &recorder{}
+	e := New(sim.NewBus(sim.NewDevice(a, r)))
+	exchange(e, 0xc1)
+
+	// Reset, data mode, skip ROM and a doubled 0xe3 sent as data
+	assert.Equal([]byte{0xcd, 0xcc, 0xe3, 0x12}, exchange(e, 0xc1, 0xe1, 0xcc, 0xe3, 0xe3, 0x12))
+	assert.Equal([]byte{0xe3, 0x12}, r.in)
+	assert.False(e.CommandMode())
+
+	// A single 0xe3 returns to command mode
+	assert.Equal([]byte{0xcd}, exchange(e, 0xe3, 0xc1))
+	assert.True(e.CommandMode())
+	assert.Nil(r.in)
+}
+
+func TestBaud(t *testing.T) {
+	assert := assert.New(t)
+
+	e := New(sim.NewBus())
+	exchange(e, 0xc1)
+
+	// The response to the change is sent at the new rate and lost
+	assert.Empty(exchange(e, 0x73))
+	assert.Equal(19200, e.Baud())
+
+	// Nothing gets through until the host matches
+	assert.Empty(exchange(e, 0x0f))
+	assert.NoError(e.SetConfig(19200, "8N1"))
+	assert.Equal([]byte{0x02}, exchange(e, 0x0f))
+}
+
+func TestPulse(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := go1wire.ParseAddress("28.000000000001.--")
+	e := New(sim.NewBus(sim.NewDevice(a, nil)))
+	exchange(e, 0xc1)
+
+	// SPUD forever, then write a 1 followed by the strong pull-up
+	assert.Equal([]byte{0x3e, 0x93}, exchange(e, 0x3f, 0x93))
+
+	// Only stopping the pulse is heard, which answers the pulse
+	assert.Empty(exchange(e, 0xc1))
+	assert.Equal([]byte{0xec}, exchange(e, 0xf1))
+	assert.Empty(exchange(e, 0xf1))
+	assert.Equal([]byte{0xcd}, exchange(e, 0xc1))
+
+	// Arming pulses, then every byte in data mode is followed by a pulse
+	assert.Empty(exchange(e, 0xef))
+	assert.Equal([]byte{0xec}, exchange(e, 0xf1))
+	assert.Equal([]byte{0xff}, exchange(e, 0xe1, 0xff))
+	assert.Empty(exchange(e, 0xff))
+	assert.Equal([]byte{0xec}, exchange(e, 0xf1))
+
+	// Disarming pulses too
+	assert.Empty(exchange(e, 0xe3, 0xed))
+	assert.Equal([]byte{0xec}, exchange(e, 0xf1))
+	assert.Equal([]byte{0xff, 0xff}, exchange(e, 0xe1, 0xff, 0xff))
+
+	// A pulse with a duration is answered when it ends
+	assert.Equal([]byte{0x30, 0xec}, exchange(e, 0xe3, 0x31, 0xed))
+}
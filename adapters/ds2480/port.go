@@ -0,0 +1,81 @@
+package ds2480
+
+import (
+	"io"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	serial "github.com/schmidtw/go232"
+)
+
+// A Port is the serial connection to the chip.  OpenSerial provides the
+// default implementation using go232; anything else (a pty, a network serial
+// server, an emulator) can be used by setting Ds2480.Port.
+type Port interface {
+	io.ReadWriter
+
+	// SetConfig changes the baud rate and framing ("8N1") of the port.
+	SetConfig(baud int, framing string) error
+
+	// SendBreak sends a break, returning the chip to its power up state.
+	SendBreak() error
+
+	// Flush discards anything waiting to be read or written.
+	Flush() error
+
+	// SetDeadline sets the time after which Read gives up waiting for data
+	// and returns an error with a Timeout method that returns true, the
+	// same as a net.Conn.  The zero value means Read waits forever.
+	SetDeadline(t time.Time) error
+}
+
+// isTimeout returns true if the error is from a read passing its deadline.
+func isTimeout(err error) bool {
+	t, ok := err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// serialPort is a Port using a go232 serial port.  The port returns from a
+// read when nothing has arrived for readPoll, which is used to provide the
+// deadline.
+type serialPort struct {
+	*serial.Serial
+	deadline time.Time
+}
+
+// OpenSerial opens the serial port with the name at 9600 8N1.
+func OpenSerial(name string) (Port, error) {
+	s := &serial.Serial{
+		Name:   name,
+		Baud:   9600,
+		Config: "8N1",
+		Vtime:  readPoll,
+	}
+	if err := s.Open(); nil != err {
+		return nil, err
+	}
+	return &serialPort{Serial: s}, nil
+}
+
+func (s *serialPort) SetConfig(baud int, framing string) error {
+	s.Baud = baud
+	s.Config = framing
+	return s.UpdateCfg()
+}
+
+func (s *serialPort) SetDeadline(t time.Time) error {
+	s.deadline = t
+	return nil
+}
+
+func (s *serialPort) Read(p []byte) (int, error) {
+	for {
+		n, err := s.Serial.Read(p)
+		if 0 < n || (nil != err && io.EOF != err) {
+			return n, err
+		}
+		if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
+			return 0, go1wire.TimeoutError{}
+		}
+	}
+}
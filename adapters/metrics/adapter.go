@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+// An Adapter is an adapter that measures every operation performed on the
+// adapter it wraps.  It is also an Observer for the adapter so NewBus picks
+// it up for the device drivers.  Its Capabilities are those of the wrapped
+// adapter; the optional operations the wrapped adapter does not provide
+// return go1wire.ErrNotSupported without being measured.
+type Adapter struct {
+	go1wire.Observer
+	adapter go1wire.Adapter
+	c       *Collector
+	name    string
+}
+
+var (
+	_ go1wire.ContextAdapter     = (*Adapter)(nil)
+	_ go1wire.BitAdapter         = (*Adapter)(nil)
+	_ go1wire.TripletAdapter     = (*Adapter)(nil)
+	_ go1wire.SearchAccelerator  = (*Adapter)(nil)
+	_ go1wire.SpeedAdapter       = (*Adapter)(nil)
+	_ go1wire.PowerAdapter       = (*Adapter)(nil)
+	_ go1wire.Observer           = (*Adapter)(nil)
+	_ go1wire.CapabilityReporter = (*Adapter)(nil)
+)
+
+// New creates an Adapter for the adapter recording to the collector under
+// the name.
+func New(a go1wire.Adapter, c *Collector, name string) *Adapter {
+	return &Adapter{
+		Observer: c.Observer(name),
+		adapter:  a,
+		c:        c,
+		name:     name,
+	}
+}
+
+// Capabilities returns the capabilities of the measured adapter.
+func (m *Adapter) Capabilities() go1wire.Capability {
+	return go1wire.Capabilities(m.adapter)
+}
+
+func (m *Adapter) Detect() (bool, error) {
+	return m.DetectContext(context.Background())
+}
+
+func (m *Adapter) DetectContext(ctx context.Context) (bool, error) {
+	start := time.Now()
+	ok, err := go1wire.DetectContext(ctx, m.adapter)
+	m.c.observe(m.name, OpDetect, start, err)
+	return ok, err
+}
+
+func (m *Adapter) Reset() (go1wire.PresenceResult, error) {
+	return m.ResetContext(context.Background())
+}
+
+func (m *Adapter) ResetContext(ctx context.Context) (go1wire.PresenceResult, error) {
+	start := time.Now()
+	p, err := go1wire.ResetContext(ctx, m.adapter)
+	m.c.observe(m.name, OpReset, start, err)
+	if nil == err {
+		m.c.resets.WithLabelValues(m.name).Inc()
+		if nil != p.Err() {
+			m.c.presence.WithLabelValues(m.name, p.String()).Inc()
+		}
+	}
+	return p, err
+}
+
+// Search walks the bus using the operations of the Adapter so each step is
+// measured as well as the whole search.  If the adapter can only search by
+// itself the search is measured as one operation.
+func (m *Adapter) Search() ([]go1wire.Address, error) {
+	return m.SearchContext(context.Background())
+}
+
+func (m *Adapter) SearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	start := time.Now()
+	var list []go1wire.Address
+	var err error
+	if 0 != m.Capabilities()&(go1wire.CapTriplet|go1wire.CapSearchPass) {
+		list, err = go1wire.NewSearch(m).All(ctx)
+	} else {
+		list, err = go1wire.SearchContext(ctx, m.adapter)
+		m.c.observe(m.name, OpSearchAll, start, err)
+	}
+	if nil == err {
+		m.c.searches.WithLabelValues(m.name).Observe(time.Since(start).Seconds())
+	}
+	return list, err
+}
+
+func (m *Adapter) TxRx(tx, rx []byte) error {
+	return m.TxRxContext(context.Background(), tx, rx)
+}
+
+func (m *Adapter) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	start := time.Now()
+	err := go1wire.TxRxContext(ctx, m.adapter, tx, rx)
+	m.c.observe(m.name, OpTxRx, start, err)
+	return err
+}
+
+func (m *Adapter) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	if 0 == m.Capabilities()&go1wire.CapBit {
+		return false, go1wire.ErrNotSupported
+	}
+	start := time.Now()
+	got, err := m.adapter.(go1wire.BitAdapter).TouchBit(ctx, bit)
+	m.c.observe(m.name, OpBit, start, err)
+	return got, err
+}
+
+func (m *Adapter) ReadBit(ctx context.Context) (bool, error) {
+	return m.TouchBit(ctx, true)
+}
+
+func (m *Adapter) WriteBit(ctx context.Context, bit bool) error {
+	_, err := m.TouchBit(ctx, bit)
+	return err
+}
+
+func (m *Adapter) Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error) {
+	if 0 == m.Capabilities()&go1wire.CapTriplet {
+		return false, false, false, go1wire.ErrNotSupported
+	}
+	start := time.Now()
+	id, cmp, taken, err = go1wire.Triplet(ctx, m.adapter, dir)
+	m.c.observe(m.name, OpBit, start, err)
+	return id, cmp, taken, err
+}
+
+func (m *Adapter) SearchPass(ctx context.Context, cmd byte, path uint64) (uint64, []int, error) {
+	if 0 == m.Capabilities()&go1wire.CapSearchPass {
+		return 0, nil, go1wire.ErrNotSupported
+	}
+	start := time.Now()
+	rom, forks, err := m.adapter.(go1wire.SearchAccelerator).SearchPass(ctx, cmd, path)
+	m.c.observe(m.name, OpSearch, start, err)
+	return rom, forks, err
+}
+
+func (m *Adapter) SetSpeed(ctx context.Context, s go1wire.Speed) error {
+	if 0 == m.Capabilities()&go1wire.CapSpeed {
+		return go1wire.ErrNotSupported
+	}
+	start := time.Now()
+	err := m.adapter.(go1wire.SpeedAdapter).SetSpeed(ctx, s)
+	m.c.observe(m.name, OpSpeed, start, err)
+	return err
+}
+
+// WriteBytePower is measured without the time the strong pull-up is held
+// since that is decided by the caller.
+func (m *Adapter) WriteBytePower(ctx context.Context, b byte, d time.Duration) error {
+	if 0 == m.Capabilities()&go1wire.CapPower {
+		return go1wire.ErrNotSupported
+	}
+	start := time.Now()
+	err := m.adapter.(go1wire.PowerAdapter).WriteBytePower(ctx, b, d)
+	took := time.Since(start) - d
+	if took < 0 {
+		took = 0
+	}
+	m.c.latency.WithLabelValues(m.name, OpPower).Observe(took.Seconds())
+	if nil != err {
+		m.c.errors.WithLabelValues(m.name, OpPower, errorLabel(err)).Inc()
+	}
+	return err
+}
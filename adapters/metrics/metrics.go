@@ -0,0 +1,172 @@
+// Package metrics exposes the health of 1-Wire buses as Prometheus metrics.
+// An Adapter wraps the adapter of a bus and measures every operation, while
+// the go1wire.Observer hooks report the problems adapters and device drivers
+// handle themselves.  A slowly rising count of resyncs, CRC errors or missing
+// presence pulses usually points at a degrading cable well before readings
+// stop.
+//
+//	c := metrics.NewCollector()
+//	prometheus.MustRegister(c)
+//
+//	a := metrics.New(ds, c, "usb0")
+//	ds.Observer = a
+//	bus := go1wire.NewBus(a)
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/schmidtw/go1wire"
+)
+
+const namespace = "onewire"
+
+// The operations measured.
+const (
+	OpDetect    = "detect"
+	OpReset     = "reset"
+	OpTxRx      = "txrx"
+	OpBit       = "bit"
+	OpSearch    = "searchpass"
+	OpSearchAll = "search" // By an adapter that can only search by itself
+	OpSpeed     = "speed"
+	OpPower     = "power"
+)
+
+// A Collector holds the metrics of any number of adapters, each identified by
+// the name given to New.
+type Collector struct {
+	resets   *prometheus.CounterVec
+	presence *prometheus.CounterVec
+	crc      *prometheus.CounterVec
+	resyncs  *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	searches *prometheus.HistogramVec
+	latency  *prometheus.HistogramVec
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates a Collector.  It must be registered to be exported.
+func NewCollector() *Collector {
+	return &Collector{
+		resets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "resets_total",
+			Help:      "Number of bus resets.",
+		}, []string{"adapter"}),
+		presence: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "presence_failures_total",
+			Help:      "Number of bus resets without a presence pulse or with the bus shorted.",
+		}, []string{"adapter", "result"}),
+		crc: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "crc_errors_total",
+			Help:      "Number of reads from a device that failed the CRC check.",
+		}, []string{"adapter", "address"}),
+		resyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "resyncs_total",
+			Help:      "Number of times the adapter resynchronized with its hardware after an invalid response.",
+		}, []string{"adapter"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Number of transactions retried by kind of error.",
+		}, []string{"adapter", "error"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of failed operations by kind of error.",
+		}, []string{"adapter", "op", "error"}),
+		searches: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "search_duration_seconds",
+			Help:      "Time taken to search the bus for all the devices.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"adapter"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Time taken by each operation on the adapter.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"adapter", "op"}),
+	}
+}
+
+func (c *Collector) vectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.resets, c.presence, c.crc, c.resyncs, c.retries, c.errors, c.searches, c.latency,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, v := range c.vectors() {
+		v.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, v := range c.vectors() {
+		v.Collect(ch)
+	}
+}
+
+// Observer returns an observer that counts the problems reported for the
+// adapter with the name.
+func (c *Collector) Observer(adapter string) go1wire.Observer {
+	return &observer{c: c, adapter: adapter}
+}
+
+type observer struct {
+	c       *Collector
+	adapter string
+}
+
+func (o *observer) CRCError(a go1wire.Address) {
+	o.c.crc.WithLabelValues(o.adapter, a.String()).Inc()
+}
+
+func (o *observer) Resync() {
+	o.c.resyncs.WithLabelValues(o.adapter).Inc()
+}
+
+// OnRetry returns a function that counts the retries of transactions on the
+// adapter with the name.  It is meant for retry.Policy.OnRetry.
+func (c *Collector) OnRetry(adapter string) func(attempt int, err error) {
+	return func(attempt int, err error) {
+		c.retries.WithLabelValues(adapter, errorLabel(err)).Inc()
+	}
+}
+
+// observe records the duration and result of an operation.
+func (c *Collector) observe(adapter, op string, start time.Time, err error) {
+	c.latency.WithLabelValues(adapter, op).Observe(time.Since(start).Seconds())
+	if nil != err && go1wire.ErrNotSupported != err {
+		c.errors.WithLabelValues(adapter, op, errorLabel(err)).Inc()
+	}
+}
+
+// errorLabel provides a short name for the kind of error.
+func errorLabel(err error) string {
+	switch {
+	case errors.Is(err, go1wire.ErrInvalidResponse):
+		return "invalid_response"
+	case errors.Is(err, go1wire.ErrCRC):
+		return "crc"
+	case errors.Is(err, go1wire.ErrNoPresence):
+		return "no_presence"
+	case errors.Is(err, go1wire.ErrBusShorted):
+		return "shorted"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "context"
+	}
+	return "other"
+}
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/schmidtw/go1wire/devices/ds18x20"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(t *testing.T, s string) go1wire.Address {
+	a, err := go1wire.ParseAddress(s)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// noisyBus corrupts the last byte read by every exchange longer than a byte.
+type noisyBus struct {
+	*sim.Bus
+}
+
+func (n *noisyBus) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	err := n.Bus.TxRxContext(ctx, tx, rx)
+	if 1 < len(rx) && 0xff == tx[len(tx)-1] {
+		rx[len(rx)-1] ^= 0x01
+	}
+	return err
+}
+
+func TestAdapter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a := mustParse(t, "28.000000000001.--")
+	b20 := sim.NewDS18B20(a)
+	s := sim.NewBus(b20.Device)
+
+	c := NewCollector()
+	bus := go1wire.NewBus(New(s, c, "sim"))
+
+	got, err := bus.Search(ctx)
+	assert.NoError(err)
+	assert.Equal([]go1wire.Address{a}, got)
+	assert.Equal(1, testutil.CollectAndCount(c.searches))
+	assert.Equal(float64(1), testutil.ToFloat64(c.resets.WithLabelValues("sim")))
+
+	d, err := ds18x20.New(bus, a)
+	if assert.NoError(err) {
+		_, err = d.LastTempContext(ctx)
+		assert.NoError(err)
+	}
+	assert.Equal(float64(2), testutil.ToFloat64(c.resets.WithLabelValues("sim")))
+	assert.Equal(0, testutil.CollectAndCount(c.crc))
+
+	// Nobody there
+	s.Detach(a)
+	assert.Equal(go1wire.ErrNoPresence, bus.Reset(ctx))
+	assert.Equal(float64(1), testutil.ToFloat64(c.presence.WithLabelValues("sim", "none")))
+
+	// Unsupported operations are not errors
+	_, _, err = New(s, c, "sim").SearchPass(ctx, 0xf0, 0)
+	assert.Equal(go1wire.ErrNotSupported, err)
+	assert.Equal(0, testutil.CollectAndCount(c.errors))
+
+	// Nothing is put on the bus for overdrive without the speed
+	plain := New(struct{ go1wire.Adapter }{s}, c, "plain")
+	assert.Equal(go1wire.Capability(0), go1wire.Capabilities(plain))
+	assert.Equal(go1wire.ErrNotSupported, go1wire.NewBus(plain).OverdriveSkipROM(ctx))
+	assert.Equal(float64(0), testutil.ToFloat64(c.resets.WithLabelValues("plain")))
+
+	// The adapter can only search by itself
+	s.Attach(b20.Device)
+	ops := testutil.CollectAndCount(c.latency)
+	got, err = go1wire.NewBus(plain).Search(ctx)
+	assert.NoError(err)
+	assert.Equal([]go1wire.Address{a}, got)
+	assert.Equal(2, testutil.CollectAndCount(c.searches))
+	assert.Equal(ops+1, testutil.CollectAndCount(c.latency))
+
+	// The collector can be registered
+	assert.NoError(prometheus.NewRegistry().Register(c))
+}
+
+func TestObserver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a := mustParse(t, "28.000000000001.--")
+	c := NewCollector()
+	m := New(&noisyBus{sim.NewBus(sim.NewDS18B20(a).Device)}, c, "noisy")
+	bus := go1wire.NewBus(m)
+
+	d, err := ds18x20.New(bus, a)
+	if assert.NoError(err) {
+		_, err = d.LastTempContext(ctx)
+		assert.True(errors.Is(err, go1wire.ErrCRC))
+	}
+	assert.Equal(float64(1), testutil.ToFloat64(c.crc.WithLabelValues("noisy", a.String())))
+
+	m.Resync()
+	m.Resync()
+	assert.Equal(float64(2), testutil.ToFloat64(c.resyncs.WithLabelValues("noisy")))
+
+	c.OnRetry("noisy")(1, go1wire.ErrInvalidResponse)
+	assert.Equal(float64(1), testutil.ToFloat64(c.retries.WithLabelValues("noisy", "invalid_response")))
+}
+
+func TestErrorLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("invalid_response", errorLabel(go1wire.ErrInvalidResponse))
+	assert.Equal("crc", errorLabel(&go1wire.CRCError{Expected: 1, Actual: 2}))
+	assert.Equal("no_presence", errorLabel(go1wire.ErrNoPresence))
+	assert.Equal("shorted", errorLabel(go1wire.ErrBusShorted))
+	assert.Equal("context", errorLabel(context.Canceled))
+	assert.Equal("other", errorLabel(go1wire.ErrNoDriver))
+}
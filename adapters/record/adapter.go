@@ -0,0 +1,330 @@
+package record
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/internal/wire"
+)
+
+// A Recorder is an adapter that records every operation performed on the
+// adapter it wraps.  Its Capabilities are those of the wrapped adapter; the
+// optional operations the wrapped adapter does not provide return
+// go1wire.ErrNotSupported without being recorded.
+type Recorder struct {
+	*writer
+	adapter go1wire.Adapter
+}
+
+var (
+	_ go1wire.ContextAdapter     = (*Recorder)(nil)
+	_ go1wire.BitAdapter         = (*Recorder)(nil)
+	_ go1wire.TripletAdapter     = (*Recorder)(nil)
+	_ go1wire.SearchAccelerator  = (*Recorder)(nil)
+	_ go1wire.SpeedAdapter       = (*Recorder)(nil)
+	_ go1wire.PowerAdapter       = (*Recorder)(nil)
+	_ go1wire.CapabilityReporter = (*Recorder)(nil)
+)
+
+// NewRecorder creates a Recorder for the adapter writing to w.  The
+// capabilities of the adapter are recorded first.
+func NewRecorder(a go1wire.Adapter, w io.Writer) *Recorder {
+	r := &Recorder{writer: newWriter(w), adapter: a}
+	r.write(Record{Op: OpCapabilities, Value: uint64(r.Capabilities())}, nil)
+	return r
+}
+
+// Capabilities returns the capabilities of the recorded adapter.
+func (r *Recorder) Capabilities() go1wire.Capability {
+	return go1wire.Capabilities(r.adapter)
+}
+
+func (r *Recorder) Detect() (bool, error) {
+	return r.DetectContext(context.Background())
+}
+
+func (r *Recorder) DetectContext(ctx context.Context) (bool, error) {
+	ok, err := go1wire.DetectContext(ctx, r.adapter)
+	rec := Record{Op: OpDetect}
+	if ok {
+		rec.Value = 1
+	}
+	r.write(rec, err)
+	return ok, err
+}
+
+func (r *Recorder) Reset() (go1wire.PresenceResult, error) {
+	return r.ResetContext(context.Background())
+}
+
+func (r *Recorder) ResetContext(ctx context.Context) (go1wire.PresenceResult, error) {
+	p, err := go1wire.ResetContext(ctx, r.adapter)
+	r.write(Record{Op: OpReset, Value: uint64(p)}, err)
+	return p, err
+}
+
+// Search walks the bus using the operations of the Recorder so each step is
+// recorded.  If the adapter can only search by itself the addresses found are
+// recorded instead.
+func (r *Recorder) Search() ([]go1wire.Address, error) {
+	return r.SearchContext(context.Background())
+}
+
+func (r *Recorder) SearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	if 0 != r.Capabilities()&(go1wire.CapTriplet|go1wire.CapSearchPass) {
+		return go1wire.NewSearch(r).All(ctx)
+	}
+	list, err := go1wire.SearchContext(ctx, r.adapter)
+	r.write(Record{Op: OpSearch, Addresses: list}, err)
+	return list, err
+}
+
+func (r *Recorder) TxRx(tx, rx []byte) error {
+	return r.TxRxContext(context.Background(), tx, rx)
+}
+
+func (r *Recorder) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	err := go1wire.TxRxContext(ctx, r.adapter, tx, rx)
+	r.write(Record{Op: OpTxRx, Tx: wire.Copy(tx), Rx: wire.Copy(rx)}, err)
+	return err
+}
+
+func (r *Recorder) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	if 0 == r.Capabilities()&go1wire.CapBit {
+		return false, go1wire.ErrNotSupported
+	}
+	got, err := r.adapter.(go1wire.BitAdapter).TouchBit(ctx, bit)
+	r.write(Record{Op: OpBit, Tx: wire.Bits(bit), Rx: wire.Bits(got)}, err)
+	return got, err
+}
+
+func (r *Recorder) ReadBit(ctx context.Context) (bool, error) {
+	return r.TouchBit(ctx, true)
+}
+
+func (r *Recorder) WriteBit(ctx context.Context, bit bool) error {
+	_, err := r.TouchBit(ctx, bit)
+	return err
+}
+
+func (r *Recorder) Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error) {
+	if 0 == r.Capabilities()&go1wire.CapTriplet {
+		return false, false, false, go1wire.ErrNotSupported
+	}
+	id, cmp, taken, err = go1wire.Triplet(ctx, r.adapter, dir)
+	r.write(Record{Op: OpTriplet, Tx: wire.Bits(dir), Rx: wire.Bits(id, cmp, taken)}, err)
+	return id, cmp, taken, err
+}
+
+func (r *Recorder) SearchPass(ctx context.Context, cmd byte, path uint64) (uint64, []int, error) {
+	if 0 == r.Capabilities()&go1wire.CapSearchPass {
+		return 0, nil, go1wire.ErrNotSupported
+	}
+	rom, forks, err := r.adapter.(go1wire.SearchAccelerator).SearchPass(ctx, cmd, path)
+	r.write(Record{Op: OpSearchPass, Tx: searchTx(cmd, path), Rx: uint64Bytes(rom), Forks: forks}, err)
+	return rom, forks, err
+}
+
+func (r *Recorder) SetSpeed(ctx context.Context, s go1wire.Speed) error {
+	if 0 == r.Capabilities()&go1wire.CapSpeed {
+		return go1wire.ErrNotSupported
+	}
+	err := r.adapter.(go1wire.SpeedAdapter).SetSpeed(ctx, s)
+	r.write(Record{Op: OpSpeed, Value: uint64(s)}, err)
+	return err
+}
+
+func (r *Recorder) WriteBytePower(ctx context.Context, b byte, d time.Duration) error {
+	if 0 == r.Capabilities()&go1wire.CapPower {
+		return go1wire.ErrNotSupported
+	}
+	err := r.adapter.(go1wire.PowerAdapter).WriteBytePower(ctx, b, d)
+	r.write(Record{Op: OpPower, Tx: []byte{b}, Duration: d}, err)
+	return err
+}
+
+// A Replayer is an adapter that replays a recording made by a Recorder.  Each
+// operation must match the next one recorded, otherwise an error wrapping
+// ErrMismatch is returned.  Time is not replayed; operations return right
+// away.  Its Capabilities are those recorded; recordings without them are
+// assumed to support everything.
+type Replayer struct {
+	*reader
+	caps go1wire.Capability
+}
+
+var (
+	_ go1wire.ContextAdapter     = (*Replayer)(nil)
+	_ go1wire.BitAdapter         = (*Replayer)(nil)
+	_ go1wire.TripletAdapter     = (*Replayer)(nil)
+	_ go1wire.SearchAccelerator  = (*Replayer)(nil)
+	_ go1wire.SpeedAdapter       = (*Replayer)(nil)
+	_ go1wire.PowerAdapter       = (*Replayer)(nil)
+	_ go1wire.CapabilityReporter = (*Replayer)(nil)
+)
+
+// NewReplayer creates a Replayer from the recording.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	list, err := ReadAll(r)
+	if nil != err {
+		return nil, err
+	}
+
+	caps := go1wire.CapBit | go1wire.CapTriplet | go1wire.CapSearchPass |
+		go1wire.CapSpeed | go1wire.CapPower
+	if 0 < len(list) && OpCapabilities == list[0].Op {
+		caps = go1wire.Capability(list[0].Value)
+		list = list[1:]
+	}
+
+	return &Replayer{reader: &reader{records: list}, caps: caps}, nil
+}
+
+// Capabilities returns the capabilities of the adapter recorded.
+func (r *Replayer) Capabilities() go1wire.Capability {
+	return r.caps
+}
+
+func (r *Replayer) Detect() (bool, error) {
+	return r.DetectContext(context.Background())
+}
+
+func (r *Replayer) DetectContext(ctx context.Context) (bool, error) {
+	rec, err := r.next(OpDetect)
+	if nil != err {
+		return false, err
+	}
+	return 0 != rec.Value, rec.error()
+}
+
+func (r *Replayer) Reset() (go1wire.PresenceResult, error) {
+	return r.ResetContext(context.Background())
+}
+
+func (r *Replayer) ResetContext(ctx context.Context) (go1wire.PresenceResult, error) {
+	rec, err := r.next(OpReset)
+	if nil != err {
+		return go1wire.PresenceNone, err
+	}
+	return go1wire.PresenceResult(rec.Value), rec.error()
+}
+
+func (r *Replayer) Search() ([]go1wire.Address, error) {
+	return r.SearchContext(context.Background())
+}
+
+func (r *Replayer) SearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	if 0 != r.caps&(go1wire.CapTriplet|go1wire.CapSearchPass) {
+		return go1wire.NewSearch(r).All(ctx)
+	}
+	rec, err := r.next(OpSearch)
+	if nil != err {
+		return nil, err
+	}
+	return rec.Addresses, rec.error()
+}
+
+func (r *Replayer) TxRx(tx, rx []byte) error {
+	return r.TxRxContext(context.Background(), tx, rx)
+}
+
+func (r *Replayer) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	rec, err := r.nextTx(OpTxRx, tx)
+	if nil != err {
+		return err
+	}
+	copy(rx, rec.Rx)
+	return rec.error()
+}
+
+func (r *Replayer) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	if 0 == r.caps&go1wire.CapBit {
+		return false, go1wire.ErrNotSupported
+	}
+	rec, err := r.nextTx(OpBit, wire.Bits(bit))
+	if nil == err && len(rec.Rx) < 1 {
+		err = mismatch(OpBit)
+	}
+	if nil != err {
+		return false, err
+	}
+	return 0 != rec.Rx[0], rec.error()
+}
+
+func (r *Replayer) ReadBit(ctx context.Context) (bool, error) {
+	return r.TouchBit(ctx, true)
+}
+
+func (r *Replayer) WriteBit(ctx context.Context, bit bool) error {
+	_, err := r.TouchBit(ctx, bit)
+	return err
+}
+
+func (r *Replayer) Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error) {
+	if 0 == r.caps&go1wire.CapTriplet {
+		return false, false, false, go1wire.ErrNotSupported
+	}
+	rec, err := r.nextTx(OpTriplet, wire.Bits(dir))
+	if nil == err && len(rec.Rx) < 3 {
+		err = mismatch(OpTriplet)
+	}
+	if nil != err {
+		return false, false, false, err
+	}
+	return 0 != rec.Rx[0], 0 != rec.Rx[1], 0 != rec.Rx[2], rec.error()
+}
+
+func (r *Replayer) SearchPass(ctx context.Context, cmd byte, path uint64) (uint64, []int, error) {
+	if 0 == r.caps&go1wire.CapSearchPass {
+		return 0, nil, go1wire.ErrNotSupported
+	}
+	rec, err := r.nextTx(OpSearchPass, searchTx(cmd, path))
+	if nil == err && len(rec.Rx) < 8 {
+		err = mismatch(OpSearchPass)
+	}
+	if nil != err {
+		return 0, nil, err
+	}
+	return binary.LittleEndian.Uint64(rec.Rx), rec.Forks, rec.error()
+}
+
+func (r *Replayer) SetSpeed(ctx context.Context, s go1wire.Speed) error {
+	if 0 == r.caps&go1wire.CapSpeed {
+		return go1wire.ErrNotSupported
+	}
+	rec, err := r.next(OpSpeed)
+	if nil != err {
+		return err
+	}
+	if uint64(s) != rec.Value {
+		return mismatch(OpSpeed)
+	}
+	return rec.error()
+}
+
+func (r *Replayer) WriteBytePower(ctx context.Context, b byte, d time.Duration) error {
+	if 0 == r.caps&go1wire.CapPower {
+		return go1wire.ErrNotSupported
+	}
+	rec, err := r.nextTx(OpPower, []byte{b})
+	if nil != err {
+		return err
+	}
+	if d != rec.Duration {
+		return mismatch(OpPower)
+	}
+	return rec.error()
+}
+
+func uint64Bytes(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
+
+func searchTx(cmd byte, path uint64) []byte {
+	return append([]byte{cmd}, uint64Bytes(path)...)
+}
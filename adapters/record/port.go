@@ -0,0 +1,137 @@
+package record
+
+import (
+	"io"
+	"time"
+
+	"github.com/schmidtw/go1wire/adapters/ds2480"
+	"github.com/schmidtw/go1wire/internal/wire"
+)
+
+// A PortRecorder is a ds2480.Port that records the byte stream to and from
+// the port it wraps.  Deadlines are passed on but not recorded; a read that
+// times out is.
+type PortRecorder struct {
+	*writer
+	port ds2480.Port
+}
+
+var _ ds2480.Port = (*PortRecorder)(nil)
+
+// NewPortRecorder creates a PortRecorder for the port writing to w.
+func NewPortRecorder(p ds2480.Port, w io.Writer) *PortRecorder {
+	return &PortRecorder{writer: newWriter(w), port: p}
+}
+
+func (p *PortRecorder) Read(b []byte) (int, error) {
+	n, err := p.port.Read(b)
+	p.write(Record{Op: OpRead, Rx: wire.Copy(b[:n])}, err)
+	return n, err
+}
+
+func (p *PortRecorder) Write(b []byte) (int, error) {
+	n, err := p.port.Write(b)
+	p.write(Record{Op: OpWrite, Tx: wire.Copy(b[:n])}, err)
+	return n, err
+}
+
+func (p *PortRecorder) SetConfig(baud int, framing string) error {
+	err := p.port.SetConfig(baud, framing)
+	p.write(Record{Op: OpSetConfig, Value: uint64(baud), Text: framing}, err)
+	return err
+}
+
+func (p *PortRecorder) SendBreak() error {
+	err := p.port.SendBreak()
+	p.write(Record{Op: OpBreak}, err)
+	return err
+}
+
+func (p *PortRecorder) Flush() error {
+	err := p.port.Flush()
+	p.write(Record{Op: OpFlush}, err)
+	return err
+}
+
+func (p *PortRecorder) SetDeadline(t time.Time) error {
+	return p.port.SetDeadline(t)
+}
+
+// Close closes the wrapped port if it can be closed.
+func (p *PortRecorder) Close() error {
+	if c, ok := p.port.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// A PortReplayer is a ds2480.Port that replays a recording made by a
+// PortRecorder.  Each operation must match the next one recorded, otherwise
+// an error wrapping ErrMismatch is returned.
+type PortReplayer struct {
+	*reader
+}
+
+var _ ds2480.Port = (*PortReplayer)(nil)
+
+// NewPortReplayer creates a PortReplayer from the recording.
+func NewPortReplayer(r io.Reader) (*PortReplayer, error) {
+	list, err := ReadAll(r)
+	if nil != err {
+		return nil, err
+	}
+	return &PortReplayer{reader: &reader{records: list}}, nil
+}
+
+// Read returns the bytes of the next recorded read.  The recorded read must
+// fit in b.
+func (p *PortReplayer) Read(b []byte) (int, error) {
+	rec, err := p.next(OpRead)
+	if nil == err && len(b) < len(rec.Rx) {
+		err = mismatch(OpRead)
+	}
+	if nil != err {
+		return 0, err
+	}
+	return copy(b, rec.Rx), rec.error()
+}
+
+func (p *PortReplayer) Write(b []byte) (int, error) {
+	rec, err := p.nextTx(OpWrite, b)
+	if nil != err {
+		return 0, err
+	}
+	return len(rec.Tx), rec.error()
+}
+
+func (p *PortReplayer) SetConfig(baud int, framing string) error {
+	rec, err := p.next(OpSetConfig)
+	if nil != err {
+		return err
+	}
+	if uint64(baud) != rec.Value || framing != rec.Text {
+		return mismatch(OpSetConfig)
+	}
+	return rec.error()
+}
+
+func (p *PortReplayer) SendBreak() error {
+	rec, err := p.next(OpBreak)
+	if nil != err {
+		return err
+	}
+	return rec.error()
+}
+
+func (p *PortReplayer) Flush() error {
+	rec, err := p.next(OpFlush)
+	if nil != err {
+		return err
+	}
+	return rec.error()
+}
+
+// SetDeadline does nothing as deadlines are not recorded.
+func (p *PortReplayer) SetDeadline(t time.Time) error {
+	return nil
+}
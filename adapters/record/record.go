@@ -0,0 +1,216 @@
+// Package record captures the traffic of an adapter, or of the serial port
+// under a ds2480 adapter, into a file with timestamps and replays it later as
+// a fake adapter or port.  A recording made at a customer site can be turned
+// into a regression test without the hardware.
+//
+// Recordings are JSON lines, one Record per operation.  Operations the
+// recorded adapter does not support are not recorded.
+package record
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+var (
+	ErrMismatch = errors.New("onewire: operation does not match the recording")
+	ErrEnd      = errors.New("onewire: end of recording")
+)
+
+// The operations recorded.
+const (
+	OpDetect     = "detect"
+	OpReset      = "reset"
+	OpTxRx       = "txrx"
+	OpBit        = "bit"
+	OpTriplet    = "triplet"
+	OpSearchPass = "searchpass"
+	OpSearch     = "search"
+	OpSpeed      = "speed"
+	OpPower      = "power"
+
+	// OpCapabilities is the first record of an adapter recording and holds
+	// the go1wire.Capabilities of the adapter recorded.
+	OpCapabilities = "capabilities"
+
+	OpRead      = "read"
+	OpWrite     = "write"
+	OpFlush     = "flush"
+	OpBreak     = "break"
+	OpSetConfig = "setconfig"
+)
+
+// Hex is a byte slice that is stored as a hex string.
+type Hex []byte
+
+func (h Hex) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+func (h *Hex) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if nil != err {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+// A Record is a single recorded operation.  Which fields are used depends on
+// the operation.
+type Record struct {
+	Time      time.Time         `json:"time"`
+	Op        string            `json:"op"`
+	Tx        Hex               `json:"tx,omitempty"`
+	Rx        Hex               `json:"rx,omitempty"`
+	Value     uint64            `json:"value,omitempty"`
+	Forks     []int             `json:"forks,omitempty"`
+	Addresses []go1wire.Address `json:"addresses,omitempty"`
+	Duration  time.Duration     `json:"duration,omitempty"`
+	Text      string            `json:"text,omitempty"`
+	Err       string            `json:"err,omitempty"`
+}
+
+// errors that are recreated when replayed so they can still be compared.
+var knownErrors = []error{
+	go1wire.ErrNotSupported,
+	go1wire.ErrNoPresence,
+	go1wire.ErrBusShorted,
+	go1wire.ErrInvalidResponse,
+	go1wire.ErrCRC,
+	context.Canceled,
+	context.DeadlineExceeded,
+	io.EOF,
+}
+
+const timeoutPrefix = "timeout: "
+
+func errorString(err error) string {
+	if nil == err {
+		return ""
+	}
+	if t, ok := err.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return timeoutPrefix + err.Error()
+	}
+	return err.Error()
+}
+
+func (r *Record) error() error {
+	if "" == r.Err {
+		return nil
+	}
+	for _, known := range knownErrors {
+		if known.Error() == r.Err {
+			return known
+		}
+	}
+	if len(r.Err) > len(timeoutPrefix) && timeoutPrefix == r.Err[:len(timeoutPrefix)] {
+		return go1wire.TimeoutError{}
+	}
+	return errors.New(r.Err)
+}
+
+// writer writes records as JSON lines.  The first error is kept and stops
+// any further writes.
+type writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+	err error
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{enc: json.NewEncoder(w), now: time.Now}
+}
+
+func (w *writer) write(r Record, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if nil != w.err {
+		return
+	}
+	r.Time = w.now()
+	r.Err = errorString(err)
+	w.err = w.enc.Encode(&r)
+}
+
+// Err returns the first error writing the recording.
+func (w *writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// reader hands out the records of a recording in order.
+type reader struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// ReadAll reads all the records of a recording.
+func ReadAll(r io.Reader) ([]Record, error) {
+	var list []Record
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		err := dec.Decode(&rec)
+		if io.EOF == err {
+			return list, nil
+		}
+		if nil != err {
+			return nil, err
+		}
+		list = append(list, rec)
+	}
+}
+
+// next returns the next record, which must be for the operation.
+func (r *reader) next(op string) (Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if 0 == len(r.records) {
+		return Record{}, ErrEnd
+	}
+	rec := r.records[0]
+	if op != rec.Op {
+		return Record{}, fmt.Errorf("%w: expected %s got %s", ErrMismatch, rec.Op, op)
+	}
+	r.records = r.records[1:]
+	return rec, nil
+}
+
+// nextTx returns the next record, which must be for the operation and have
+// sent tx.
+func (r *reader) nextTx(op string, tx []byte) (Record, error) {
+	rec, err := r.next(op)
+	if nil != err {
+		return rec, err
+	}
+	if hex.EncodeToString(tx) != hex.EncodeToString(rec.Tx) {
+		return Record{}, fmt.Errorf("%w: %s expected % x got % x", ErrMismatch, op, []byte(rec.Tx), tx)
+	}
+	return rec, nil
+}
+
+func mismatch(op string) error {
+	return fmt.Errorf("%w: %s arguments differ", ErrMismatch, op)
+}
+
+// Remaining returns the number of records not replayed yet.
+func (r *reader) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.records)
+}
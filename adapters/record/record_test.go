@@ -0,0 +1,213 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/ds2480"
+	"github.com/schmidtw/go1wire/adapters/ds2480/emulator"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSimBus(t *testing.T) (*sim.Bus, []go1wire.Address) {
+	var roms []go1wire.Address
+	for _, s := range []string{
+		"10.450736030800.--",
+		"28.000000000001.--",
+		"28.000000000002.--",
+	} {
+		a, err := go1wire.ParseAddress(s)
+		require.NoError(t, err)
+		roms = append(roms, a)
+	}
+
+	therm := sim.NewDS18B20(roms[1])
+	therm.SetTemp(21.5)
+	return sim.NewBus(
+		sim.NewDevice(roms[0], nil),
+		therm.Device,
+		sim.NewDevice(roms[2], nil),
+	), roms
+}
+
+// session is a set of operations that is recorded and then replayed.
+func session(ctx context.Context, a go1wire.Adapter, target go1wire.Address) ([]go1wire.Address, []byte, error) {
+	bus := go1wire.NewBus(a)
+
+	list, err := bus.Search(ctx)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	rx := make([]byte, 10)
+	err = bus.Do(ctx, func(tx *go1wire.Tx) error {
+		if err := tx.MatchROM(target); nil != err {
+			return err
+		}
+		if err := tx.WriteBytePower(0x44, time.Second); nil != err {
+			return err
+		}
+		if err := tx.MatchROM(target); nil != err {
+			return err
+		}
+		return tx.TxRx([]byte{0xbe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, rx)
+	})
+
+	return list, rx, err
+}
+
+func TestAdapter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	b, roms := newSimBus(t)
+
+	var buf bytes.Buffer
+	rec := NewRecorder(b, &buf)
+	ok, err := rec.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+	list, rx, err := session(ctx, rec, roms[1])
+	require.NoError(t, err)
+	assert.NoError(rec.Err())
+	assert.ElementsMatch(roms, list)
+	assert.Equal([]byte{0x58, 0x01}, rx[1:3])
+
+	// Each line is a record, starting with the capabilities
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Contains(lines[0], `"op":"capabilities"`)
+	assert.Contains(lines[2], `"op":"reset","value":1`)
+	assert.NotContains(buf.String(), OpSearchPass)
+
+	recording := buf.Bytes()
+	play, err := NewReplayer(bytes.NewReader(recording))
+	require.NoError(t, err)
+	assert.Equal(go1wire.Capabilities(rec), go1wire.Capabilities(play))
+	ok, err = play.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+	list2, rx2, err := session(ctx, play, roms[1])
+	assert.NoError(err)
+	assert.Equal(list, list2)
+	assert.Equal(rx, rx2)
+	assert.Equal(0, play.Remaining())
+	assert.Equal(ErrEnd, play.TxRx([]byte{0xcc}, nil))
+
+	// A different target doesn't match
+	play, err = NewReplayer(bytes.NewReader(recording))
+	require.NoError(t, err)
+	play.Detect()
+	_, _, err = session(ctx, play, roms[2])
+	assert.True(errors.Is(err, ErrMismatch))
+}
+
+func TestAdapterErrors(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	rec := NewRecorder(sim.NewBus(), &buf)
+
+	// Nothing on the bus and missing features
+	bus := go1wire.NewBus(rec)
+	assert.Equal(go1wire.ErrNoPresence, bus.SkipROM(ctx))
+	_, _, err := rec.SearchPass(ctx, go1wire.ROM_SEARCH, 0)
+	assert.Equal(go1wire.ErrNotSupported, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(context.Canceled, rec.TxRxContext(canceled, []byte{0xcc}, nil))
+
+	play, err := NewReplayer(&buf)
+	require.NoError(t, err)
+	bus = go1wire.NewBus(play)
+	assert.Equal(go1wire.ErrNoPresence, bus.SkipROM(ctx))
+	_, _, err = play.SearchPass(ctx, go1wire.ROM_SEARCH, 0)
+	assert.Equal(go1wire.ErrNotSupported, err)
+	assert.Equal(context.Canceled, play.TxRx([]byte{0xcc}, nil))
+	assert.Equal(0, play.Remaining())
+
+	// Nothing is put on the bus for overdrive without the speed
+	buf.Reset()
+	rec = NewRecorder(struct{ go1wire.Adapter }{sim.NewBus()}, &buf)
+	assert.Equal(go1wire.Capability(0), go1wire.Capabilities(rec))
+	assert.Equal(go1wire.ErrNotSupported, go1wire.NewBus(rec).OverdriveSkipROM(ctx))
+	play, err = NewReplayer(&buf)
+	require.NoError(t, err)
+	assert.Equal(go1wire.Capability(0), go1wire.Capabilities(play))
+	assert.Equal(go1wire.ErrNotSupported, go1wire.NewBus(play).OverdriveSkipROM(ctx))
+	assert.Equal(0, play.Remaining())
+
+	// Recordings without the capabilities support everything
+	play, err = NewReplayer(strings.NewReader(`{"op":"speed","value":1}`))
+	require.NoError(t, err)
+	assert.NoError(play.SetSpeed(ctx, go1wire.SpeedOverdrive))
+}
+
+func TestAdapterSearchOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	// The adapter can only search by itself
+	b, roms := newSimBus(t)
+	var buf bytes.Buffer
+	rec := NewRecorder(struct{ go1wire.Adapter }{b}, &buf)
+	list, err := rec.Search()
+	assert.NoError(err)
+	assert.ElementsMatch(roms, list)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(lines, 2) {
+		assert.Contains(lines[1], `"op":"search"`)
+	}
+
+	play, err := NewReplayer(&buf)
+	require.NoError(t, err)
+	list2, err := play.Search()
+	assert.NoError(err)
+	assert.Equal(list, list2)
+	assert.Equal(0, play.Remaining())
+}
+
+func TestPort(t *testing.T) {
+	assert := assert.New(t)
+
+	b, roms := newSimBus(t)
+	e := emulator.New(b)
+
+	var buf bytes.Buffer
+	d := &ds2480.Ds2480{Port: NewPortRecorder(e, &buf)}
+	require.NoError(t, d.Init())
+	require.NoError(t, d.Open())
+
+	ok, err := d.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+	list, err := d.Search()
+	assert.NoError(err)
+	assert.ElementsMatch(roms, list)
+	assert.NoError(d.Close())
+
+	play, err := NewPortReplayer(&buf)
+	require.NoError(t, err)
+	d = &ds2480.Ds2480{Port: play}
+	require.NoError(t, d.Init())
+	require.NoError(t, d.Open())
+
+	ok, err = d.Detect()
+	assert.NoError(err)
+	assert.True(ok)
+	list2, err := d.Search()
+	assert.NoError(err)
+	assert.Equal(list, list2)
+	assert.Equal(0, play.Remaining())
+
+	// Something else was sent
+	_, err = play.Write([]byte{0xc1})
+	assert.Equal(ErrEnd, err)
+}
@@ -0,0 +1,251 @@
+package sim
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+// A Function is the function layer of a simulated device.  Once the device
+// has been selected by a ROM command the bus is handed to the Function one
+// byte at a time.
+type Function interface {
+	// Reset is called when the bus is reset.
+	Reset()
+
+	// Out returns the byte the device drives onto the bus during the next
+	// 8 time slots.  Bits set to 1 leave the bus released.
+	Out() byte
+
+	// In is called with the byte seen on the bus after the 8 time slots.
+	In(b byte)
+}
+
+// An Alarmer is a Function that takes part in the alarm search when its alarm
+// condition is met.
+type Alarmer interface {
+	Alarm() bool
+}
+
+// A PowerUser is a Function that draws power from the strong pull-up.
+type PowerUser interface {
+	// StrongPullUp is called after a byte written with the strong pull-up
+	// held for the duration.
+	StrongPullUp(d time.Duration)
+}
+
+type romState int
+
+const (
+	stateIdle romState = iota
+	stateRom
+	stateSearch
+	stateMatch
+	stateRead
+	stateFunction
+)
+
+// A Device is a simulated device.  It responds to the ROM commands using its
+// address and passes the function commands on to its Function.
+type Device struct {
+	// Overdrive is set if the device supports overdrive speed.
+	Overdrive bool
+
+	address  go1wire.Address
+	rom      uint64
+	function Function
+
+	state     romState
+	cmd       byte
+	bit       int
+	slot      int
+	resume    bool
+	overdrive bool
+	out, in   byte
+}
+
+// NewDevice creates a device with the address and function layer.  The
+// function may be nil for devices that only have a ROM.
+func NewDevice(a go1wire.Address, f Function) *Device {
+	return &Device{
+		address:  a,
+		rom:      binary.LittleEndian.Uint64(a.Bytes()),
+		function: f,
+	}
+}
+
+// Address returns the address of the device.
+func (d *Device) Address() go1wire.Address {
+	return d.address
+}
+
+// Function returns the function layer of the device.
+func (d *Device) Function() Function {
+	return d.function
+}
+
+// listening returns true if the device follows the bus at the speed.
+func (d *Device) listening(s go1wire.Speed) bool {
+	return d.overdrive == (go1wire.SpeedOverdrive == s)
+}
+
+// reset handles a reset pulse at the speed and returns true if the device
+// sends a presence pulse.
+func (d *Device) reset(s go1wire.Speed) bool {
+	if go1wire.SpeedStandard == s {
+		d.overdrive = false
+	} else if !d.overdrive {
+		// Too short for a standard speed device to notice.
+		return false
+	}
+
+	d.state = stateRom
+	d.cmd = 0
+	d.bit = 0
+	if nil != d.function {
+		d.function.Reset()
+	}
+
+	return true
+}
+
+func (d *Device) romBit() bool {
+	return 0 != 1&(d.rom>>uint(d.bit))
+}
+
+// drive returns the level the device drives during the next time slot.
+func (d *Device) drive(s go1wire.Speed) bool {
+	if !d.listening(s) {
+		return true
+	}
+
+	switch d.state {
+	case stateSearch:
+		switch d.slot {
+		case 0:
+			return d.romBit()
+		case 1:
+			return !d.romBit()
+		}
+	case stateRead:
+		return d.romBit()
+	case stateFunction:
+		if 0 == d.bit {
+			d.out = 0xff
+			if nil != d.function {
+				d.out = d.function.Out()
+			}
+		}
+		return 0 != 1&(d.out>>uint(d.bit))
+	}
+
+	return true
+}
+
+// sample handles the level seen on the bus at the end of the time slot.
+func (d *Device) sample(s go1wire.Speed, line bool) {
+	if !d.listening(s) {
+		return
+	}
+
+	switch d.state {
+	case stateRom:
+		if line {
+			d.cmd |= 1 << uint(d.bit)
+		}
+		d.bit++
+		if 8 == d.bit {
+			d.command()
+		}
+
+	case stateSearch:
+		if d.slot < 2 {
+			d.slot++
+			return
+		}
+		d.slot = 0
+		if line != d.romBit() {
+			d.state = stateIdle
+			return
+		}
+		d.bit++
+		if 64 == d.bit {
+			d.selected(true)
+		}
+
+	case stateMatch:
+		if line != d.romBit() {
+			d.state = stateIdle
+			return
+		}
+		d.bit++
+		if 64 == d.bit {
+			d.selected(true)
+		}
+
+	case stateRead:
+		d.bit++
+		if 64 == d.bit {
+			d.selected(d.resume)
+		}
+
+	case stateFunction:
+		if line {
+			d.in |= 1 << uint(d.bit)
+		}
+		d.bit++
+		if 8 == d.bit {
+			d.bit = 0
+			if nil != d.function {
+				d.function.In(d.in)
+			}
+			d.in = 0
+		}
+	}
+}
+
+// command handles the ROM command received.
+func (d *Device) command() {
+	d.bit = 0
+	d.slot = 0
+	d.state = stateIdle
+
+	switch d.cmd {
+	case go1wire.ROM_SEARCH:
+		d.state = stateSearch
+	case go1wire.ROM_ALARM_SEARCH:
+		if a, ok := d.function.(Alarmer); ok && a.Alarm() {
+			d.state = stateSearch
+		}
+	case go1wire.ROM_READ:
+		d.state = stateRead
+	case go1wire.ROM_MATCH:
+		d.resume = false
+		d.state = stateMatch
+	case go1wire.ROM_SKIP:
+		d.selected(false)
+	case go1wire.ROM_RESUME:
+		if d.resume {
+			d.selected(true)
+		}
+	case go1wire.ROM_OVERDRIVE_SKIP:
+		if d.Overdrive {
+			d.overdrive = true
+			d.selected(false)
+		}
+	case go1wire.ROM_OVERDRIVE_MATCH:
+		if d.Overdrive {
+			d.overdrive = true
+			d.resume = false
+			d.state = stateMatch
+		}
+	}
+}
+
+func (d *Device) selected(resume bool) {
+	d.resume = resume
+	d.state = stateFunction
+	d.bit = 0
+	d.in = 0
+}
@@ -0,0 +1,220 @@
+// Package sim provides an in-memory 1-wire bus with simulated devices so
+// drivers can be tested without hardware.
+package sim
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+// A Bus is a simulated 1-wire bus.  It is a go1wire.Adapter that provides
+// the bit level, speed and power operations.  Every time slot is shared by
+// all the attached devices, so devices collide the same way they do on a
+// real bus.
+//
+// Time does not pass on the simulated bus; operations complete immediately.
+type Bus struct {
+	mu      sync.Mutex
+	devices []*Device
+	speed   go1wire.Speed
+}
+
+var (
+	_ go1wire.ContextAdapter = (*Bus)(nil)
+	_ go1wire.BitAdapter     = (*Bus)(nil)
+	_ go1wire.SpeedAdapter   = (*Bus)(nil)
+	_ go1wire.PowerAdapter   = (*Bus)(nil)
+)
+
+// NewBus creates a Bus with the devices attached.
+func NewBus(devices ...*Device) *Bus {
+	return &Bus{devices: devices}
+}
+
+// Attach connects the device to the bus.
+func (b *Bus) Attach(d *Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.devices = append(b.devices, d)
+}
+
+// Detach disconnects the device with the address from the bus.
+func (b *Bus) Detach(a go1wire.Address) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, d := range b.devices {
+		if a == d.address {
+			b.devices = append(b.devices[:i], b.devices[i+1:]...)
+			return
+		}
+	}
+}
+
+// Devices returns the devices attached to the bus.
+func (b *Bus) Devices() []*Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]*Device{}, b.devices...)
+}
+
+func (b *Bus) Detect() (bool, error) {
+	return b.DetectContext(context.Background())
+}
+
+func (b *Bus) DetectContext(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); nil != err {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *Bus) Reset() (go1wire.PresenceResult, error) {
+	return b.ResetContext(context.Background())
+}
+
+func (b *Bus) ResetContext(ctx context.Context) (go1wire.PresenceResult, error) {
+	if err := ctx.Err(); nil != err {
+		return go1wire.PresenceNone, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rv := go1wire.PresenceNone
+	for _, d := range b.devices {
+		if d.reset(b.speed) {
+			rv = go1wire.PresenceDetected
+		}
+	}
+	return rv, nil
+}
+
+func (b *Bus) Search() ([]go1wire.Address, error) {
+	return b.SearchContext(context.Background())
+}
+
+func (b *Bus) SearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	return go1wire.NewSearch(b).All(ctx)
+}
+
+func (b *Bus) TxRx(tx, rx []byte) error {
+	return b.TxRxContext(context.Background(), tx, rx)
+}
+
+func (b *Bus) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, v := range tx {
+		got := b.byte(v)
+		if i < len(rx) {
+			rx[i] = got
+		}
+	}
+	return nil
+}
+
+func (b *Bus) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	if err := ctx.Err(); nil != err {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.slot(bit), nil
+}
+
+func (b *Bus) ReadBit(ctx context.Context) (bool, error) {
+	return b.TouchBit(ctx, true)
+}
+
+func (b *Bus) WriteBit(ctx context.Context, bit bool) error {
+	_, err := b.TouchBit(ctx, bit)
+	return err
+}
+
+// SetSpeed changes the speed of the bus.  Only the devices running at the
+// speed follow the time slots.
+func (b *Bus) SetSpeed(ctx context.Context, s go1wire.Speed) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.speed = s
+	return nil
+}
+
+// WriteBytePower writes the byte then tells the selected devices that the
+// strong pull-up was held for the duration.
+func (b *Bus) WriteBytePower(ctx context.Context, v byte, d time.Duration) error {
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if v != b.byte(v) {
+		return go1wire.ErrInvalidResponse
+	}
+
+	b.strongPullUp(d)
+	return nil
+}
+
+// StrongPullUp tells the selected devices that the strong pull-up was held
+// for the duration.  It is used by adapters emulated on top of the Bus.
+func (b *Bus) StrongPullUp(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.strongPullUp(d)
+}
+
+func (b *Bus) strongPullUp(d time.Duration) {
+	for _, dev := range b.devices {
+		if p, ok := dev.function.(PowerUser); ok && stateFunction == dev.state {
+			p.StrongPullUp(d)
+		}
+	}
+}
+
+// byte performs 8 time slots, least significant bit first.
+func (b *Bus) byte(v byte) byte {
+	var rv byte
+	for i := uint(0); i < 8; i++ {
+		if b.slot(0 != 1&(v>>i)) {
+			rv |= 1 << i
+		}
+	}
+	return rv
+}
+
+// slot performs a single time slot.  The bus is low if the master or any
+// device pulls it low.
+func (b *Bus) slot(bit bool) bool {
+	line := bit
+	for _, d := range b.devices {
+		if !d.drive(b.speed) {
+			line = false
+		}
+	}
+	for _, d := range b.devices {
+		d.sample(b.speed, line)
+	}
+	return line
+}
@@ -0,0 +1,295 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// memory is a Function that records the bytes written and replies with
+// reply.
+type memory struct {
+	in    []byte
+	reply []byte
+}
+
+func (m *memory) Reset() { m.in = nil }
+func (m *memory) Out() byte {
+	if len(m.in) < len(m.reply) {
+		return m.reply[len(m.in)]
+	}
+	return 0xff
+}
+func (m *memory) In(b byte) { m.in = append(m.in, b) }
+
+func mustParse(t *testing.T, list ...string) []go1wire.Address {
+	var rv []go1wire.Address
+	for _, s := range list {
+		a, err := go1wire.ParseAddress(s)
+		if nil != err {
+			t.Fatal(err)
+		}
+		rv = append(rv, a)
+	}
+	return rv
+}
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"10.450736030800.--",
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"28.800000000002.--",
+		"01.4507360308ff.--",
+	)
+
+	b := NewBus()
+	for _, a := range roms {
+		b.Attach(NewDevice(a, nil))
+	}
+
+	got, err := b.SearchContext(ctx)
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms, got)
+	}
+
+	got, err = go1wire.SearchFamily(ctx, b, 0x28)
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms[1:4], got)
+	}
+
+	b.Detach(roms[0])
+	got, err = b.SearchContext(ctx)
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms[1:], got)
+	}
+	assert.Len(b.Devices(), 4)
+
+	// Nothing on the bus
+	empty := NewBus()
+	p, err := empty.Reset()
+	assert.NoError(err)
+	assert.Equal(go1wire.PresenceNone, p)
+	got, err = empty.Search()
+	assert.NoError(err)
+	assert.Empty(got)
+}
+
+func TestAlarmSearch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"10.450736030800.--",
+	)
+
+	hot := NewDS18B20(roms[0])
+	cold := NewDS18B20(roms[1])
+	b := NewBus(hot.Device, cold.Device, NewDevice(roms[2], nil))
+
+	// No alarms before the first conversion
+	got, err := go1wire.AlarmSearch(ctx, b)
+	assert.NoError(err)
+	assert.Empty(got)
+
+	hot.SetTemp(80)
+	cold.SetTemp(72)
+	bus := go1wire.NewBus(b)
+	assert.NoError(bus.SkipROM(ctx))
+	assert.NoError(bus.Write(ctx, []byte{thermConvert}))
+
+	got, err = go1wire.AlarmSearch(ctx, b)
+	if assert.NoError(err) {
+		assert.Equal(roms[:1], got)
+	}
+}
+
+func TestRomCommands(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"28.000000000002.--",
+	)
+	m0 := &memory{reply: []byte{0xff, 0x34}}
+	m1 := &memory{reply: []byte{0xff, 0x78}}
+	b := NewBus(NewDevice(roms[0], m0), NewDevice(roms[1], m1))
+	bus := go1wire.NewBus(b)
+
+	rx := make([]byte, 3)
+	assert.NoError(bus.MatchROM(ctx, roms[1]))
+	assert.NoError(bus.TxRx(ctx, []byte{0xaa, 0xff, 0xff}, rx))
+	assert.Equal([]byte{0xaa, 0x78, 0xff}, rx)
+	assert.Nil(m0.in)
+	assert.Equal([]byte{0xaa, 0x78, 0xff}, m1.in)
+
+	// Resume the last matched device
+	assert.NoError(bus.ResumeROM(ctx))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff, 0xff}, rx[:2]))
+	assert.Equal([]byte{0xff, 0x78}, rx[:2])
+	assert.Nil(m0.in)
+
+	// Both devices talk at once
+	assert.NoError(bus.SkipROM(ctx))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff, 0xff}, rx[:2]))
+	assert.Equal([]byte{0xff, 0x34 & 0x78}, rx[:2])
+
+	// Resume is cleared by skip
+	assert.NoError(bus.ResumeROM(ctx))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff}, rx[:1]))
+	assert.Equal(byte(0xff), rx[0])
+
+	// Read ROM only works with a single device
+	_, err := bus.ReadROM(ctx)
+	assert.Error(err)
+	b.Detach(roms[0])
+	a, err := bus.ReadROM(ctx)
+	if assert.NoError(err) {
+		assert.Equal(roms[1], a)
+	}
+}
+
+func TestOverdrive(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"2d.000000000001.--",
+		"28.000000000002.--",
+	)
+	m0 := &memory{reply: []byte{0x12}}
+	m1 := &memory{reply: []byte{0x56}}
+	od := NewDevice(roms[0], m0)
+	od.Overdrive = true
+	b := NewBus(od, NewDevice(roms[1], m1))
+	bus := go1wire.NewBus(b)
+
+	rx := make([]byte, 1)
+	assert.NoError(bus.OverdriveSkipROM(ctx))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff}, rx))
+	assert.Equal([]byte{0x12}, rx)
+
+	// Only the overdrive device answers an overdrive reset
+	assert.NoError(bus.SkipROM(ctx))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff}, rx))
+	assert.Equal([]byte{0x12}, rx)
+	assert.Nil(m1.in)
+
+	// Back to standard speed
+	assert.NoError(bus.Standard(ctx))
+	assert.NoError(bus.SkipROM(ctx))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff}, rx))
+	assert.Equal([]byte{0x12 & 0x56}, rx)
+
+	assert.NoError(bus.OverdriveMatchROM(ctx, roms[0]))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff}, rx))
+	assert.Equal([]byte{0x12}, rx)
+	assert.NoError(bus.Standard(ctx))
+
+	// Standard devices ignore overdrive match
+	assert.NoError(bus.OverdriveMatchROM(ctx, roms[1]))
+	assert.NoError(bus.TxRx(ctx, []byte{0xff}, rx))
+	assert.Equal([]byte{0xff}, rx)
+	assert.Nil(m1.in)
+	assert.NoError(bus.Standard(ctx))
+}
+
+func TestThermometer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a := mustParse(t, "28.000000000001.--")[0]
+	therm := NewDS18B20(a)
+	b := NewBus(therm.Device)
+	bus := go1wire.NewBus(b)
+
+	// Power on value and default registers
+	assert.Equal([]byte{0x50, 0x05, 0x4b, 0x46, 0x7f, 0xff, 0x0c, 0x10}, therm.ScratchPad()[:8])
+
+	// 9-bit resolution clears the low bits
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermWriteScratchPad, 0x20, 0xf6, 0x1f}))
+	therm.SetTemp(-10.1875)
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermConvert}))
+
+	rx := make([]byte, 10)
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.TxRx(ctx, []byte{thermReadScratchPad,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, rx))
+	// -10.0 at 9-bit resolution with the undefined bits set
+	assert.Equal([]byte{0x67, 0xff, 0x20, 0xf6, 0x1f}, rx[1:6])
+	assert.NoError(go1wire.CheckCrc8(rx[1:]))
+
+	// Copy & recall
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermCopyScratchPad}))
+	assert.Equal([]byte{0x20, 0xf6, 0x1f}, therm.EEPROM())
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermWriteScratchPad, 0x00, 0x00, 0x7f}))
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermRecallE2}))
+	assert.Equal([]byte{0x20, 0xf6, 0x1f}, therm.ScratchPad()[2:5])
+
+	// Parasite power needs the strong pull-up
+	therm.SetParasite(true)
+	therm.SetTemp(25)
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.TxRx(ctx, []byte{thermReadPowerSupply, 0xff}, rx[:2]))
+	assert.Equal([]byte{thermReadPowerSupply, 0xfe}, rx[:2])
+
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermConvert}))
+	assert.Equal([]byte{0x67, 0xff}, therm.ScratchPad()[:2])
+
+	power := func(d time.Duration) func(tx *go1wire.Tx) error {
+		return func(tx *go1wire.Tx) error {
+			if err := tx.MatchROM(a); nil != err {
+				return err
+			}
+			return tx.WriteBytePower(thermConvert, d)
+		}
+	}
+	assert.NoError(bus.Do(ctx, power(10*time.Millisecond)))
+	assert.Equal([]byte{0x67, 0xff}, therm.ScratchPad()[:2])
+	assert.NoError(bus.Do(ctx, power(100*time.Millisecond)))
+	assert.Equal([]byte{0x97, 0x01}, therm.ScratchPad()[:2])
+}
+
+func TestDS18S20(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a := mustParse(t, "10.450736030800.--")[0]
+	therm := NewDS18S20(a)
+	bus := go1wire.NewBus(NewBus(therm.Device))
+
+	assert.Equal([]byte{0xaa, 0x00, 0x4b, 0x46, 0xff, 0xff, 0x0c, 0x10}, therm.ScratchPad()[:8])
+
+	therm.SetTemp(-0.5)
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermConvert}))
+	assert.Equal([]byte{0xff, 0xff}, therm.ScratchPad()[:2])
+
+	therm.SetTemp(21.875)
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermConvert}))
+	// 22 - 0.25 + (16 - 14)/16
+	assert.Equal([]byte{0x2c, 0x00}, therm.ScratchPad()[:2])
+	assert.Equal(byte(14), therm.ScratchPad()[6])
+
+	// Only TH & TL are written
+	assert.NoError(bus.MatchROM(ctx, a))
+	assert.NoError(bus.Write(ctx, []byte{thermWriteScratchPad, 0x10, 0x01, 0x00}))
+	assert.Equal([]byte{0x10, 0x01, 0xff}, therm.ScratchPad()[2:5])
+	assert.NoError(go1wire.CheckCrc8(therm.ScratchPad()))
+}
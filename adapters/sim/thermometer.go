@@ -0,0 +1,268 @@
+package sim
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+// The function commands of the DS18S20 and DS18B20.
+const (
+	thermConvert         = 0x44
+	thermReadScratchPad  = 0xbe
+	thermWriteScratchPad = 0x4e
+	thermCopyScratchPad  = 0x48
+	thermRecallE2        = 0xb8
+	thermReadPowerSupply = 0xb4
+)
+
+// A Thermometer simulates a DS18S20 or DS18B20.  The scratchpad starts with
+// the power-on value of 85C until the first conversion.
+//
+// A parasite powered Thermometer only completes a conversion or copy if the
+// strong pull-up is held long enough.
+type Thermometer struct {
+	// Device is the device to attach to a Bus.
+	Device *Device
+
+	mu       sync.Mutex
+	b20      bool
+	temp     float64
+	parasite bool
+
+	scratch [9]byte
+	eeprom  [3]byte
+
+	cmd        byte
+	pos        int
+	pending    byte
+	alarmKnown bool
+}
+
+// NewDS18S20 creates a simulated DS18S20.
+func NewDS18S20(a go1wire.Address) *Thermometer {
+	return newThermometer(a, false)
+}
+
+// NewDS18B20 creates a simulated DS18B20 set to 12-bit resolution.
+func NewDS18B20(a go1wire.Address) *Thermometer {
+	return newThermometer(a, true)
+}
+
+func newThermometer(a go1wire.Address, b20 bool) *Thermometer {
+	t := &Thermometer{
+		b20:    b20,
+		temp:   85.0,
+		eeprom: [3]byte{0x4b, 0x46, 0x7f},
+	}
+	t.Device = NewDevice(a, t)
+
+	t.recall()
+	t.convert()
+	return t
+}
+
+// SetTemp sets the temperature measured by the next conversion.
+func (t *Thermometer) SetTemp(c float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.temp = c
+}
+
+// SetParasite sets if the device is parasite powered.
+func (t *Thermometer) SetParasite(p bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.parasite = p
+}
+
+// ScratchPad returns the current scratchpad including the CRC.
+func (t *Thermometer) ScratchPad() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]byte{}, t.scratch[:]...)
+}
+
+// EEPROM returns the TH, TL and configuration registers stored in EEPROM.
+// The configuration is always 0xff on a DS18S20.
+func (t *Thermometer) EEPROM() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]byte{}, t.eeprom[:]...)
+}
+
+// Alarm is true if the last temperature measured is at or above TH or at or
+// below TL.  There is no alarm until the first conversion.
+func (t *Thermometer) Alarm() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.alarmKnown {
+		return false
+	}
+
+	raw := int16(t.scratch[1])<<8 | int16(t.scratch[0])
+	whole := raw >> 1
+	if t.b20 {
+		whole = raw >> 4
+	}
+	return whole >= int16(int8(t.scratch[2])) || whole <= int16(int8(t.scratch[3]))
+}
+
+func (t *Thermometer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cmd = 0
+	t.pos = 0
+	t.pending = 0
+}
+
+func (t *Thermometer) Out() byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch t.cmd {
+	case thermReadScratchPad:
+		if t.pos < len(t.scratch) {
+			return t.scratch[t.pos]
+		}
+	case thermReadPowerSupply:
+		if t.parasite && 0 == t.pos {
+			return 0xfe
+		}
+	}
+	return 0xff
+}
+
+func (t *Thermometer) In(b byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if 0 == t.cmd {
+		t.command(b)
+		return
+	}
+
+	switch t.cmd {
+	case thermReadScratchPad, thermReadPowerSupply:
+		t.pos++
+	case thermWriteScratchPad:
+		if t.pos < 2 || (t.b20 && t.pos < 3) {
+			t.scratch[2+t.pos] = b
+			t.pos++
+			t.store()
+		}
+	}
+}
+
+// StrongPullUp completes the conversion or copy waiting for power.
+func (t *Thermometer) StrongPullUp(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch t.pending {
+	case thermConvert:
+		if d >= t.convertTime() {
+			t.convert()
+			t.alarmKnown = true
+		}
+	case thermCopyScratchPad:
+		if d >= 10*time.Millisecond {
+			t.copy()
+		}
+	}
+	t.pending = 0
+}
+
+func (t *Thermometer) command(cmd byte) {
+	t.cmd = cmd
+	t.pos = 0
+
+	switch cmd {
+	case thermConvert:
+		if t.parasite {
+			t.pending = cmd
+		} else {
+			t.convert()
+			t.alarmKnown = true
+		}
+	case thermCopyScratchPad:
+		if t.parasite {
+			t.pending = cmd
+		} else {
+			t.copy()
+		}
+	case thermRecallE2:
+		t.recall()
+		t.store()
+	}
+}
+
+func (t *Thermometer) convertTime() time.Duration {
+	if !t.b20 {
+		return 750 * time.Millisecond
+	}
+	bits := uint(0x03 & (t.scratch[4] >> 5))
+	return (750 * time.Millisecond) >> (3 - bits)
+}
+
+func (t *Thermometer) convert() {
+	if !t.b20 {
+		raw := int16(math.Round(t.temp * 2))
+		remain := 16 - int(math.Round((t.temp-float64(raw>>1)+0.25)*16))
+		if remain < 0 {
+			remain = 0
+		} else if 16 < remain {
+			remain = 16
+		}
+		t.scratch[0] = byte(raw)
+		t.scratch[1] = byte(raw >> 8)
+		t.scratch[6] = byte(remain)
+	} else {
+		// The undefined low bits are set at lower resolutions so drivers
+		// have to ignore them.
+		shift := 3 - uint(0x03&(t.scratch[4]>>5))
+		raw := int16(math.Round(t.temp*float64(int(16)>>shift))) << shift
+		raw |= 1<<shift - 1
+		t.scratch[0] = byte(raw)
+		t.scratch[1] = byte(raw >> 8)
+	}
+	t.store()
+}
+
+func (t *Thermometer) copy() {
+	copy(t.eeprom[:], t.scratch[2:5])
+	if !t.b20 {
+		t.eeprom[2] = 0xff
+	}
+}
+
+func (t *Thermometer) recall() {
+	t.scratch[2] = t.eeprom[0]
+	t.scratch[3] = t.eeprom[1]
+	if t.b20 {
+		t.scratch[4] = t.eeprom[2]
+	}
+}
+
+// store fills in the fixed registers and the CRC of the scratchpad.
+func (t *Thermometer) store() {
+	if t.b20 {
+		t.scratch[4] = 0x1f | 0x60&t.scratch[4]
+		t.scratch[5] = 0xff
+		t.scratch[6] = 0x0c
+		t.scratch[7] = 0x10
+	} else {
+		t.scratch[4] = 0xff
+		t.scratch[5] = 0xff
+		t.scratch[7] = 0x10
+	}
+	t.scratch[8] = go1wire.Crc8(t.scratch[:8])
+}
@@ -0,0 +1,215 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+// Kind is the kind of a traced event.
+type Kind string
+
+const (
+	KindDetect   Kind = "detect"
+	KindReset    Kind = "reset"
+	KindROM      Kind = "rom"
+	KindSearch   Kind = "search"
+	KindFunction Kind = "function"
+	KindData     Kind = "data"
+	KindBit      Kind = "bit"
+	KindSpeed    Kind = "speed"
+)
+
+// CRCResult is the result of checking the CRC protecting a command.
+type CRCResult string
+
+const (
+	CRCNone CRCResult = ""
+	CRCOk   CRCResult = "ok"
+	CRCBad  CRCResult = "bad"
+)
+
+// An Event is a single decoded operation on the bus.  Which fields are used
+// depends on the kind.
+type Event struct {
+	Time time.Time
+	Kind Kind
+
+	// Presence is the result of a reset.
+	Presence go1wire.PresenceResult
+
+	// Command and Name are the ROM or function command.  Name is empty if
+	// the command is not known.
+	Command byte
+	Name    string
+
+	// Address is the device selected by the ROM command, read by a READ
+	// ROM or found by a search.  It is 0 when not known, such as after a
+	// SKIP ROM.
+	Address go1wire.Address
+
+	// Tx and Rx are the bytes sent and read back after the command.
+	Tx, Rx []byte
+	CRC    CRCResult
+
+	Speed    go1wire.Speed
+	Duration time.Duration
+	Err      error
+}
+
+// String returns the event as a single line of text without the time.
+func (e Event) String() string {
+	var b strings.Builder
+
+	b.WriteString(string(e.Kind))
+	switch e.Kind {
+	case KindDetect:
+		if nil == e.Err && go1wire.PresenceDetected == e.Presence {
+			b.WriteString(" found")
+		} else if nil == e.Err {
+			b.WriteString(" not found")
+		}
+	case KindReset:
+		if nil == e.Err {
+			b.WriteString(" " + e.Presence.String())
+		}
+	case KindROM, KindSearch, KindFunction:
+		name := e.Name
+		if "" == name {
+			name = "unknown"
+		}
+		fmt.Fprintf(&b, " %s (%02x)", name, e.Command)
+	case KindSpeed:
+		if go1wire.SpeedOverdrive == e.Speed {
+			b.WriteString(" overdrive")
+		} else {
+			b.WriteString(" standard")
+		}
+	}
+
+	if 0 != e.Address {
+		b.WriteString(" " + e.Address.String())
+	}
+	if 0 < len(e.Tx) {
+		fmt.Fprintf(&b, " tx [% x]", e.Tx)
+	}
+	if 0 < len(e.Rx) {
+		fmt.Fprintf(&b, " rx [% x]", e.Rx)
+	}
+	if CRCNone != e.CRC {
+		b.WriteString(" crc " + string(e.CRC))
+	}
+	if 0 != e.Duration {
+		b.WriteString(" power " + e.Duration.String())
+	}
+	if nil != e.Err {
+		b.WriteString(" error: " + e.Err.Error())
+	}
+
+	return b.String()
+}
+
+// A Handler is given each event as it is decoded.  Handle is not called
+// concurrently by a single Tracer.
+type Handler interface {
+	Handle(e Event)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary functions
+// as handlers.
+type HandlerFunc func(e Event)
+
+// Handle calls f(e).
+func (f HandlerFunc) Handle(e Event) {
+	f(e)
+}
+
+type textHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTextHandler creates a Handler that writes each event to w as a line of
+// text prefixed by the time.
+func NewTextHandler(w io.Writer) Handler {
+	return &textHandler{w: w}
+}
+
+func (h *textHandler) Handle(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(h.w, "%s %s\n", e.Time.Format("15:04:05.000000"), e)
+}
+
+type jsonHandler struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// jsonEvent is the structured form of an Event.
+type jsonEvent struct {
+	Time     time.Time `json:"time"`
+	Kind     Kind      `json:"kind"`
+	Presence string    `json:"presence,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Address  string    `json:"address,omitempty"`
+	Tx       string    `json:"tx,omitempty"`
+	Rx       string    `json:"rx,omitempty"`
+	CRC      CRCResult `json:"crc,omitempty"`
+	Speed    string    `json:"speed,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Err      string    `json:"err,omitempty"`
+}
+
+// NewJSONHandler creates a Handler that writes each event to w as a line of
+// JSON.
+func NewJSONHandler(w io.Writer) Handler {
+	return &jsonHandler{enc: json.NewEncoder(w)}
+}
+
+func (h *jsonHandler) Handle(e Event) {
+	j := jsonEvent{
+		Time: e.Time,
+		Kind: e.Kind,
+		Name: e.Name,
+		Tx:   hex.EncodeToString(e.Tx),
+		Rx:   hex.EncodeToString(e.Rx),
+		CRC:  e.CRC,
+	}
+
+	switch e.Kind {
+	case KindDetect, KindReset:
+		if nil == e.Err {
+			j.Presence = e.Presence.String()
+		}
+	case KindROM, KindSearch, KindFunction:
+		j.Command = fmt.Sprintf("%02x", e.Command)
+	case KindSpeed:
+		j.Speed = "standard"
+		if go1wire.SpeedOverdrive == e.Speed {
+			j.Speed = "overdrive"
+		}
+	}
+	if 0 != e.Address {
+		j.Address = e.Address.String()
+	}
+	if 0 != e.Duration {
+		j.Duration = e.Duration.String()
+	}
+	if nil != e.Err {
+		j.Err = e.Err.Error()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.enc.Encode(j)
+}
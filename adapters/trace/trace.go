@@ -0,0 +1,509 @@
+// Package trace provides an adapter middleware that decodes the traffic of
+// the adapter it wraps into 1-Wire terms: resets and presence, ROM commands
+// and the device they select, function commands and their payload along with
+// the result of checking the CRC.  The decoded events are given to a Handler
+// which can write them as text or as structured records.
+//
+// Function commands are named using the Functions registered for the family
+// of the selected device.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/internal/wire"
+)
+
+var romNames = map[byte]string{
+	go1wire.ROM_READ:            "READ ROM",
+	go1wire.ROM_MATCH:           "MATCH ROM",
+	go1wire.ROM_SKIP:            "SKIP ROM",
+	go1wire.ROM_RESUME:          "RESUME",
+	go1wire.ROM_OVERDRIVE_SKIP:  "OVERDRIVE SKIP ROM",
+	go1wire.ROM_OVERDRIVE_MATCH: "OVERDRIVE MATCH ROM",
+	go1wire.ROM_SEARCH:          "SEARCH ROM",
+	go1wire.ROM_ALARM_SEARCH:    "ALARM SEARCH",
+}
+
+// state is what the tracer expects next on the bus.
+type state int
+
+const (
+	stateData     state = iota // Nothing known, everything is data
+	stateROM                   // A ROM command after a reset
+	stateAddress               // The address of a match
+	stateSearch                // The bits of a search
+	stateFunction              // A function command after a ROM command
+)
+
+// A Tracer is an adapter that decodes every operation performed on the
+// adapter it wraps and gives the events to a handler.  Its Capabilities are
+// those of the wrapped adapter; the optional operations the wrapped adapter
+// does not provide return go1wire.ErrNotSupported without an event.
+type Tracer struct {
+	adapter go1wire.Adapter
+	handler Handler
+	now     func() time.Time
+
+	mu       sync.Mutex
+	state    state
+	rom      byte
+	addr     []byte
+	bits     uint64
+	count    uint
+	selected go1wire.Address
+	target   go1wire.Address
+}
+
+var (
+	_ go1wire.ContextAdapter     = (*Tracer)(nil)
+	_ go1wire.BitAdapter         = (*Tracer)(nil)
+	_ go1wire.TripletAdapter     = (*Tracer)(nil)
+	_ go1wire.SearchAccelerator  = (*Tracer)(nil)
+	_ go1wire.SpeedAdapter       = (*Tracer)(nil)
+	_ go1wire.PowerAdapter       = (*Tracer)(nil)
+	_ go1wire.CapabilityReporter = (*Tracer)(nil)
+)
+
+// New creates a Tracer for the adapter giving the events to h.
+func New(a go1wire.Adapter, h Handler) *Tracer {
+	return &Tracer{adapter: a, handler: h, now: time.Now}
+}
+
+// Capabilities returns the capabilities of the traced adapter.
+func (t *Tracer) Capabilities() go1wire.Capability {
+	return go1wire.Capabilities(t.adapter)
+}
+
+func (t *Tracer) Detect() (bool, error) {
+	return t.DetectContext(context.Background())
+}
+
+// DetectContext detects the wrapped adapter.  The event reports the adapter
+// was found with a Presence of go1wire.PresenceDetected.
+func (t *Tracer) DetectContext(ctx context.Context) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ok, err := go1wire.DetectContext(ctx, t.adapter)
+	e := t.event(KindDetect, err)
+	if ok {
+		e.Presence = go1wire.PresenceDetected
+	}
+	t.state = stateData
+	t.handler.Handle(e)
+
+	return ok, err
+}
+
+func (t *Tracer) Reset() (go1wire.PresenceResult, error) {
+	return t.ResetContext(context.Background())
+}
+
+func (t *Tracer) ResetContext(ctx context.Context) (go1wire.PresenceResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, err := go1wire.ResetContext(ctx, t.adapter)
+	e := t.event(KindReset, err)
+	e.Presence = p
+	t.state = stateData
+	if nil == err && nil == p.Err() {
+		t.state = stateROM
+	}
+	t.handler.Handle(e)
+
+	return p, err
+}
+
+// Search walks the bus using the operations of the Tracer so each step is
+// traced.  If the adapter can only search by itself a search event is given
+// for each address it found.
+func (t *Tracer) Search() ([]go1wire.Address, error) {
+	return t.SearchContext(context.Background())
+}
+
+func (t *Tracer) SearchContext(ctx context.Context) ([]go1wire.Address, error) {
+	if 0 != t.Capabilities()&(go1wire.CapTriplet|go1wire.CapSearchPass) {
+		return go1wire.NewSearch(t).All(ctx)
+	}
+	list, err := go1wire.SearchContext(ctx, t.adapter)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state = stateData
+	t.target = 0
+	if nil != err || 0 == len(list) {
+		t.searched(0, err)
+	}
+	for _, a := range list {
+		t.searched(a, nil)
+	}
+	return list, err
+}
+
+func (t *Tracer) TxRx(tx, rx []byte) error {
+	return t.TxRxContext(context.Background(), tx, rx)
+}
+
+func (t *Tracer) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := go1wire.TxRxContext(ctx, t.adapter, tx, rx)
+	t.decode(tx, rx, 0, err)
+
+	return err
+}
+
+func (t *Tracer) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	if 0 == t.Capabilities()&go1wire.CapBit {
+		return false, go1wire.ErrNotSupported
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	got, err := t.adapter.(go1wire.BitAdapter).TouchBit(ctx, bit)
+	e := t.event(KindBit, err)
+	e.Tx = wire.Bits(bit)
+	e.Rx = wire.Bits(got)
+	t.state = stateData
+	t.handler.Handle(e)
+
+	return got, err
+}
+
+func (t *Tracer) ReadBit(ctx context.Context) (bool, error) {
+	return t.TouchBit(ctx, true)
+}
+
+func (t *Tracer) WriteBit(ctx context.Context, bit bool) error {
+	_, err := t.TouchBit(ctx, bit)
+	return err
+}
+
+// Triplet performs the search triplet on the wrapped adapter.  During a
+// search the bits are collected and a single event is given once the search
+// completes.
+func (t *Tracer) Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error) {
+	if 0 == t.Capabilities()&go1wire.CapTriplet {
+		return false, false, false, go1wire.ErrNotSupported
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, cmp, taken, err = go1wire.Triplet(ctx, t.adapter, dir)
+	if stateSearch != t.state || nil != err {
+		e := t.event(KindBit, err)
+		if stateSearch == t.state {
+			e = t.event(KindSearch, err)
+			e.Command = t.rom
+			e.Name = romNames[t.rom]
+		}
+		e.Tx = wire.Bits(dir)
+		e.Rx = wire.Bits(id, cmp, taken)
+		t.state = stateData
+		t.handler.Handle(e)
+		return id, cmp, taken, err
+	}
+
+	if id && cmp {
+		// Nobody took part in the search.
+		t.found(^uint64(0), nil)
+		return id, cmp, taken, err
+	}
+
+	if taken {
+		t.bits |= 1 << t.count
+	}
+	t.count++
+	if 64 == t.count {
+		t.found(t.bits, nil)
+	}
+
+	return id, cmp, taken, err
+}
+
+func (t *Tracer) SearchPass(ctx context.Context, cmd byte, path uint64) (uint64, []int, error) {
+	if 0 == t.Capabilities()&go1wire.CapSearchPass {
+		return 0, nil, go1wire.ErrNotSupported
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rom, forks, err := t.adapter.(go1wire.SearchAccelerator).SearchPass(ctx, cmd, path)
+	t.rom = cmd
+	t.found(rom, err)
+
+	return rom, forks, err
+}
+
+func (t *Tracer) SetSpeed(ctx context.Context, s go1wire.Speed) error {
+	if 0 == t.Capabilities()&go1wire.CapSpeed {
+		return go1wire.ErrNotSupported
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.adapter.(go1wire.SpeedAdapter).SetSpeed(ctx, s)
+	e := t.event(KindSpeed, err)
+	e.Speed = s
+	if nil != err {
+		t.state = stateData
+	}
+	t.handler.Handle(e)
+
+	return err
+}
+
+func (t *Tracer) WriteBytePower(ctx context.Context, b byte, d time.Duration) error {
+	if 0 == t.Capabilities()&go1wire.CapPower {
+		return go1wire.ErrNotSupported
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.adapter.(go1wire.PowerAdapter).WriteBytePower(ctx, b, d)
+	t.decode([]byte{b}, nil, d, err)
+
+	return err
+}
+
+func (t *Tracer) event(k Kind, err error) Event {
+	return Event{Time: t.now(), Kind: k, Err: err}
+}
+
+// decode turns the bytes sent into events based on what is expected next.
+// d is the duration the strong pull-up was held after the last byte.
+func (t *Tracer) decode(tx, rx []byte, d time.Duration, err error) {
+	if nil != err {
+		e := t.event(KindData, err)
+		e.Tx = wire.Copy(tx)
+		e.Address = t.target
+		t.state = stateData
+		t.handler.Handle(e)
+		return
+	}
+
+	for 0 < len(tx) {
+		var n int
+		switch t.state {
+		case stateROM:
+			n = t.romCommand(tx, rx, d)
+		case stateAddress:
+			n = t.address(tx, rx, d)
+		case stateFunction:
+			n = t.function(tx, rx, d)
+		default:
+			n = t.data(tx, rx, d)
+		}
+		tx = tx[n:]
+		rx = part(rx, n, len(rx))
+	}
+}
+
+func (t *Tracer) romCommand(tx, rx []byte, d time.Duration) int {
+	cmd := tx[0]
+	e := t.event(KindROM, nil)
+	e.Command = cmd
+	e.Name = romNames[cmd]
+	e.Duration = d
+
+	n := 1
+	t.state = stateFunction
+	switch cmd {
+	case go1wire.ROM_MATCH, go1wire.ROM_OVERDRIVE_MATCH:
+		// The event is given once the whole address has been sent.
+		t.rom = cmd
+		t.addr = t.addr[:0]
+		t.state = stateAddress
+		return 1
+	case go1wire.ROM_SEARCH, go1wire.ROM_ALARM_SEARCH:
+		// The event is given once the search completes.
+		t.rom = cmd
+		t.bits = 0
+		t.count = 0
+		t.state = stateSearch
+		return 1
+	case go1wire.ROM_READ:
+		n = len(tx)
+		if 9 < n {
+			n = 9
+		}
+		buf := part(rx, 1, n)
+		t.target = 0
+		if 8 == len(buf) {
+			t.selected, e.CRC = check(buf)
+			t.target = t.selected
+			e.Address = t.selected
+		} else {
+			e.Rx = wire.Copy(buf)
+		}
+	case go1wire.ROM_SKIP, go1wire.ROM_OVERDRIVE_SKIP:
+		t.target = 0
+	case go1wire.ROM_RESUME:
+		t.target = t.selected
+		e.Address = t.selected
+	default:
+		t.target = 0
+		t.state = stateData
+	}
+	t.handler.Handle(e)
+
+	return n
+}
+
+func (t *Tracer) address(tx, rx []byte, d time.Duration) int {
+	n := 8 - len(t.addr)
+	if len(tx) < n {
+		n = len(tx)
+	}
+	t.addr = append(t.addr, tx[:n]...)
+	if 8 != len(t.addr) {
+		return n
+	}
+
+	e := t.event(KindROM, nil)
+	e.Command = t.rom
+	e.Name = romNames[t.rom]
+	e.Duration = d
+	t.selected, e.CRC = check(t.addr)
+	t.target = t.selected
+	e.Address = t.selected
+	t.state = stateFunction
+	t.handler.Handle(e)
+
+	return n
+}
+
+func (t *Tracer) function(tx, rx []byte, d time.Duration) int {
+	cmd := tx[0]
+	f := t.lookup(cmd)
+
+	e := t.event(KindFunction, nil)
+	e.Command = cmd
+	e.Name = f.Name
+	e.Address = t.target
+	e.Tx = wire.Copy(tx[1:])
+	e.Rx = wire.Copy(part(rx, 1, len(rx)))
+	e.Duration = d
+
+	switch f.CRC {
+	case go1wire.CRC8:
+		if 2 <= len(e.Rx) {
+			e.CRC = result(go1wire.CheckCrc8(e.Rx))
+		}
+	case go1wire.CRC16:
+		if 3 <= len(rx) {
+			e.CRC = result(go1wire.CheckCrc16(rx))
+		}
+	}
+
+	t.state = stateData
+	t.handler.Handle(e)
+
+	return len(tx)
+}
+
+func (t *Tracer) data(tx, rx []byte, d time.Duration) int {
+	e := t.event(KindData, nil)
+	e.Address = t.target
+	e.Tx = wire.Copy(tx)
+	e.Rx = wire.Copy(rx)
+	e.Duration = d
+	t.handler.Handle(e)
+
+	return len(tx)
+}
+
+// found gives the event for a completed search.
+func (t *Tracer) found(rom uint64, err error) {
+	e := t.event(KindSearch, err)
+	e.Command = t.rom
+	e.Name = romNames[t.rom]
+
+	t.state = stateData
+	t.target = 0
+	if nil == err && ^uint64(0) != rom {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, rom)
+		t.selected, e.CRC = check(buf)
+		t.target = t.selected
+		e.Address = t.selected
+		t.state = stateFunction
+	}
+	t.handler.Handle(e)
+}
+
+// searched gives the event for an address found by the adapter's own search.
+func (t *Tracer) searched(a go1wire.Address, err error) {
+	e := t.event(KindSearch, err)
+	e.Command = go1wire.ROM_SEARCH
+	e.Name = romNames[go1wire.ROM_SEARCH]
+	if 0 != a {
+		e.Address, e.CRC = check(a.Bytes())
+	}
+	t.handler.Handle(e)
+}
+
+// lookup finds the function command for the selected device.  If no single
+// device is selected the name is only known if all the families that define
+// the command agree on it.
+func (t *Tracer) lookup(cmd byte) go1wire.Function {
+	if 0 != t.target {
+		if f, ok := go1wire.LookupFamily(t.target.Family()); ok {
+			return f.Functions[cmd]
+		}
+		return go1wire.Function{}
+	}
+
+	var rv go1wire.Function
+	for _, family := range go1wire.Families() {
+		f, ok := family.Functions[cmd]
+		if !ok {
+			continue
+		}
+		if "" != rv.Name && rv != f {
+			return go1wire.Function{}
+		}
+		rv = f
+	}
+	return rv
+}
+
+// check provides the address in the buffer even if the CRC is wrong.
+func check(buf []byte) (go1wire.Address, CRCResult) {
+	a, err := go1wire.AddressFromBytes(buf)
+	if nil != err {
+		return go1wire.Address(binary.BigEndian.Uint64(buf)), CRCBad
+	}
+	return a, CRCOk
+}
+
+func result(err error) CRCResult {
+	if nil != err {
+		return CRCBad
+	}
+	return CRCOk
+}
+
+// part returns buf[i:j] limited to the length of buf.
+func part(buf []byte, i, j int) []byte {
+	if len(buf) < j {
+		j = len(buf)
+	}
+	if j < i {
+		return nil
+	}
+	return buf[i:j]
+}
@@ -0,0 +1,252 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/schmidtw/go1wire/devices/ds18x20"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(t *testing.T, s string) go1wire.Address {
+	a, err := go1wire.ParseAddress(s)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// collect provides a tracer that keeps the events as text.
+func collect(a go1wire.Adapter) (*Tracer, *[]string) {
+	var list []string
+	tr := New(a, HandlerFunc(func(e Event) {
+		list = append(list, e.String())
+	}))
+	return tr, &list
+}
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s20 := sim.NewDS18S20(mustParse(t, "10.450736030800.e7"))
+	b20 := sim.NewDS18B20(mustParse(t, "28.000000000001.--"))
+
+	tr, list := collect(sim.NewBus(s20.Device, b20.Device))
+
+	got, err := go1wire.NewBus(tr).Search(ctx)
+	assert.NoError(err)
+	assert.Len(got, 2)
+	assert.Equal([]string{
+		"reset detected",
+		"search SEARCH ROM (f0) 10.450736030800.e7 crc ok",
+		"reset detected",
+		"search SEARCH ROM (f0) 28.000000000001.40 crc ok",
+	}, *list)
+
+	// Nobody on the bus
+	tr, list = collect(sim.NewBus())
+	_, err = go1wire.NewBus(tr).Search(ctx)
+	assert.NoError(err)
+	assert.Equal([]string{"reset none"}, *list)
+
+	// The adapter can only search by itself
+	tr, list = collect(struct{ go1wire.Adapter }{sim.NewBus(s20.Device, b20.Device)})
+	got, err = go1wire.NewBus(tr).Search(ctx)
+	assert.NoError(err)
+	assert.Len(got, 2)
+	assert.Equal([]string{
+		"search SEARCH ROM (f0) 10.450736030800.e7 crc ok",
+		"search SEARCH ROM (f0) 28.000000000001.40 crc ok",
+	}, *list)
+
+	tr, list = collect(struct{ go1wire.Adapter }{sim.NewBus()})
+	_, err = go1wire.NewBus(tr).Search(ctx)
+	assert.NoError(err)
+	assert.Equal([]string{"search SEARCH ROM (f0)"}, *list)
+}
+
+func TestFunctions(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s20 := sim.NewDS18S20(mustParse(t, "10.450736030800.e7"))
+	b20 := sim.NewDS18B20(mustParse(t, "28.000000000001.--"))
+
+	tr, list := collect(sim.NewBus(s20.Device, b20.Device))
+	bus := go1wire.NewBus(tr)
+
+	d, err := ds18x20.New(bus, b20.Device.Address())
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = d.LastTempContext(ctx)
+	assert.NoError(err)
+
+	// The name is known for everything with a skip
+	assert.NoError(bus.Do(ctx, func(tx *go1wire.Tx) error {
+		if err := tx.SkipROM(); nil != err {
+			return err
+		}
+		return tx.WriteBytePower(0x44, time.Millisecond*750)
+	}))
+
+	// Unknown commands and more data
+	assert.NoError(bus.Do(ctx, func(tx *go1wire.Tx) error {
+		if err := tx.ResumeROM(); nil != err {
+			return err
+		}
+		if err := tx.Write([]byte{0x99, 0x01}); nil != err {
+			return err
+		}
+		return tx.Write([]byte{0x02})
+	}))
+
+	assert.Equal([]string{
+		"reset detected",
+		"rom MATCH ROM (55) 28.000000000001.40 crc ok",
+		"function READ SCRATCHPAD (be) 28.000000000001.40 tx [ff ff ff ff ff ff ff ff ff] rx [50 05 4b 46 7f ff 0c 10 1c] crc ok",
+		"reset detected",
+		"rom SKIP ROM (cc)",
+		"function CONVERT T (44) power 750ms",
+		"reset detected",
+		"rom RESUME (a5) 28.000000000001.40",
+		"function unknown (99) 28.000000000001.40 tx [01] rx [01]",
+		"data 28.000000000001.40 tx [02] rx [02]",
+	}, *list)
+}
+
+func TestOverdrive(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a := mustParse(t, "28.000000000001.--")
+	tr, list := collect(sim.NewBus(sim.NewDS18B20(a).Device))
+
+	assert.NoError(go1wire.NewBus(tr).OverdriveMatchROM(ctx, a))
+	assert.Equal([]string{
+		"reset detected",
+		"speed overdrive",
+		"rom OVERDRIVE MATCH ROM (69) 28.000000000001.40 crc ok",
+	}, *list)
+}
+
+// replyAdapter replies with fixed bytes.
+type replyAdapter struct {
+	reply []byte
+}
+
+func (r *replyAdapter) Detect() (bool, error) { return true, nil }
+func (r *replyAdapter) Reset() (go1wire.PresenceResult, error) {
+	return go1wire.PresenceAlarming, nil
+}
+func (r *replyAdapter) Search() ([]go1wire.Address, error) { return nil, nil }
+func (r *replyAdapter) TxRx(tx, rx []byte) error {
+	copy(rx, r.reply)
+	return nil
+}
+
+func TestCRC(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	r := &replyAdapter{reply: []byte{0x33, 0x10, 0x45, 0x07, 0x36, 0x03, 0x08, 0x00, 0x00}}
+	tr, list := collect(r)
+	bus := go1wire.NewBus(tr)
+
+	_, err := bus.ReadROM(ctx)
+	assert.Error(err)
+
+	r.reply = []byte{0xbe, 0x90, 0x01, 0x4b, 0x46, 0x7f, 0xff, 0x10, 0x10, 0x00}
+	assert.NoError(bus.Do(ctx, func(tx *go1wire.Tx) error {
+		if err := tx.MatchROM(mustParse(t, "28.000000000001.--")); nil != err {
+			return err
+		}
+		return tx.TxRx([]byte{0xbe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, make([]byte, 10))
+	}))
+
+	assert.Equal([]string{
+		"reset alarming",
+		"rom READ ROM (33) 10.450736030800.00 crc bad",
+		"reset alarming",
+		"rom MATCH ROM (55) 28.000000000001.40 crc ok",
+		"function READ SCRATCHPAD (be) 28.000000000001.40 tx [ff ff ff ff ff ff ff ff ff] rx [90 01 4b 46 7f ff 10 10 00] crc bad",
+	}, *list)
+}
+
+func TestErrors(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	tr, list := collect(&replyAdapter{})
+	bus := go1wire.NewBus(tr)
+
+	ok, err := tr.Detect()
+	assert.True(ok)
+	assert.NoError(err)
+	// Nothing is put on the bus when the adapter can't change the speed.
+	assert.Equal(go1wire.Capability(0), go1wire.Capabilities(tr))
+	assert.Equal(go1wire.ErrNotSupported, bus.OverdriveSkipROM(ctx))
+	assert.Equal(go1wire.ErrNotSupported, bus.OverdriveMatchROM(ctx, mustParse(t, "28.000000000001.--")))
+	_, err = tr.ReadBit(ctx)
+	assert.Equal(go1wire.ErrNotSupported, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(context.Canceled, tr.TxRxContext(cancelled, []byte{0xcc}, make([]byte, 1)))
+
+	assert.Equal([]string{
+		"detect found",
+		"data tx [cc] error: context canceled",
+	}, *list)
+}
+
+func TestHandlers(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	when := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	a := mustParse(t, "28.000000000001.--")
+	bus := sim.NewBus(sim.NewDS18B20(a).Device)
+
+	var text bytes.Buffer
+	tr := New(bus, NewTextHandler(&text))
+	tr.now = func() time.Time { return when }
+	assert.NoError(go1wire.NewBus(tr).MatchROM(ctx, a))
+	assert.Equal("03:04:05.000006 reset detected\n"+
+		"03:04:05.000006 rom MATCH ROM (55) 28.000000000001.40 crc ok\n", text.String())
+
+	var out bytes.Buffer
+	tr = New(bus, NewJSONHandler(&out))
+	tr.now = func() time.Time { return when }
+	assert.NoError(go1wire.NewBus(tr).Do(ctx, func(tx *go1wire.Tx) error {
+		if err := tx.MatchROM(a); nil != err {
+			return err
+		}
+		return tx.Write([]byte{0x44})
+	}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !assert.Len(lines, 3) {
+		return
+	}
+	var got []map[string]string
+	for _, line := range lines {
+		m := map[string]string{}
+		assert.NoError(json.Unmarshal([]byte(line), &m))
+		got = append(got, m)
+	}
+	assert.Equal([]map[string]string{
+		{"time": "2020-01-02T03:04:05.000006Z", "kind": "reset", "presence": "detected"},
+		{"time": "2020-01-02T03:04:05.000006Z", "kind": "rom", "command": "55", "name": "MATCH ROM",
+			"address": "28.000000000001.40", "crc": "ok"},
+		{"time": "2020-01-02T03:04:05.000006Z", "kind": "function", "command": "44", "name": "CONVERT T",
+			"address": "28.000000000001.40"},
+	}, got)
+}
@@ -4,9 +4,13 @@
 package go1wire
 
 import (
+	"database/sql/driver"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 // An Address represents the unique 64-bit ROM code of a 1-wire device.
@@ -27,9 +31,8 @@ func (a Address) Family() byte {
 
 // Provides the canonical string representation of the address
 func (a Address) String() string {
-	sn := uint64(0x00ffffffffffff00&a) >> 8
 	crc := uint64(a & 0xff)
-	return fmt.Sprintf("%02x.%012x.%02x", a.Family(), sn, crc)
+	return fmt.Sprintf("%02x.%012x.%02x", a.Family(), a.serial(), crc)
 }
 
 // Provides an array of bytes that represents the address.
@@ -39,40 +42,148 @@ func (a Address) Bytes() []byte {
 	return buf
 }
 
-// Creates an Address from the canonical string version.
+// An AddressFormat selects one of the common string forms of an Address.
+type AddressFormat int
+
+const (
+	// FormatCanonical is family.serial.crc with the serial in bus order,
+	// lowercase: 28.1c3b6a050000.72
+	FormatCanonical AddressFormat = iota
+
+	// FormatSysfs is the form used by the Linux w1 driver, family-serial
+	// with the 48-bit serial number: 28-0000056a3b1c
+	FormatSysfs
+
+	// FormatOWFS is the form used by OWFS, family.serial with the serial in
+	// bus order, uppercase: 28.1C3B6A050000
+	FormatOWFS
+
+	// FormatOWFSCRC is FormatOWFS with the crc: 28.1C3B6A050000.72
+	FormatOWFSCRC
+
+	// FormatHex is the 16 hex digits of the ROM in bus order:
+	// 281c3b6a05000072
+	FormatHex
+
+	// FormatHexReversed is the 16 hex digits of the ROM in reverse bus order:
+	// 720000056a3b1c28
+	FormatHexReversed
+)
+
+// Format provides the string representation of the address in the format.
+func (a Address) Format(f AddressFormat) string {
+	buf := a.Bytes()
+
+	switch f {
+	case FormatSysfs:
+		return fmt.Sprintf("%02x-%012x", a.Family(), sysfsSerial(a.serial()))
+	case FormatOWFS:
+		return fmt.Sprintf("%02X.%012X", a.Family(), a.serial())
+	case FormatOWFSCRC:
+		return fmt.Sprintf("%02X.%012X.%02X", a.Family(), a.serial(), buf[7])
+	case FormatHex:
+		return fmt.Sprintf("%016x", uint64(a))
+	case FormatHexReversed:
+		return fmt.Sprintf("%016x", binary.LittleEndian.Uint64(buf))
+	}
+
+	return a.String()
+}
+
+// serial provides the 48-bit serial number in bus order.
+func (a Address) serial() uint64 {
+	return uint64(0x00ffffffffffff00&a) >> 8
+}
+
+// sysfsSerial converts between the serial in bus order and the 48-bit serial
+// number used by the Linux w1 driver.
+func sysfsSerial(sn uint64) uint64 {
+	var rv uint64
+	for i := 0; i < 6; i++ {
+		rv = rv<<8 | 0xff&(sn>>(8*uint(i)))
+	}
+	return rv
+}
+
+// Creates an Address from any of the common string versions.
 //
-// Format (all characters are expected to be in hex):
-//     crc.serial.family
+// Formats (all characters are expected to be in hex, either case):
+//     family.serial.crc   canonical & OWFS with crc: 10.450736030800.e7
+//     family.serial       OWFS: 10.450736030800
+//     family-serial       Linux sysfs: 10-000803360745
+//     familyserialcrc     16 digits in bus order or reverse bus order
+//     familyserial        14 digits in bus order
 //
-// If the crc value is "--" then it will be calculated and not verified.
+// The serial is in bus order except for the sysfs form.  If the crc value is
+// "--" or missing then it will be calculated and not verified.
 func ParseAddress(s string) (Address, error) {
+	in := strings.ToLower(strings.TrimSpace(s))
 
-	var family uint8
-	var sn uint64
-	var crcStr string
-	cnt, err := fmt.Sscanf(s, "%x.%x.%s", &family, &sn, &crcStr)
+	if parts := strings.Split(in, "."); 1 < len(parts) {
+		switch len(parts) {
+		case 2:
+			return addressFromParts(s, parts[0], parts[1], "--", false)
+		case 3:
+			return addressFromParts(s, parts[0], parts[1], parts[2], false)
+		}
+		return 0, invalidAddress(s)
+	}
 
-	if (nil != err) || (3 != cnt) || (sn != (0xffffffffffff & sn)) {
-		return 0, errors.New("onewire: invalid address " + s)
+	if parts := strings.Split(in, "-"); 2 == len(parts) {
+		return addressFromParts(s, parts[0], parts[1], "--", true)
 	}
-	a := sn<<8 | (uint64(family) << 56)
 
-	buf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(buf, sn<<8|(uint64(family)<<56))
+	switch len(in) {
+	case 14:
+		return addressFromParts(s, in[:2], in[2:], "--", false)
+	case 16:
+		v, err := strconv.ParseUint(in, 16, 64)
+		if nil != err {
+			return 0, invalidAddress(s)
+		}
+		a, err := AddressFromUint64(v)
+		if nil != err {
+			if r, rerr := AddressFromSearch(v); nil == rerr {
+				return r, nil
+			}
+		}
+		return a, err
+	}
+
+	return 0, invalidAddress(s)
+}
 
-	crc := RevCrc8(buf[1:])
+func addressFromParts(s, familyStr, snStr, crcStr string, sysfs bool) (Address, error) {
+	family, err := strconv.ParseUint(familyStr, 16, 8)
+	if nil != err {
+		return 0, invalidAddress(s)
+	}
+	sn, err := strconv.ParseUint(snStr, 16, 48)
+	if nil != err {
+		return 0, invalidAddress(s)
+	}
+	if sysfs {
+		sn = sysfsSerial(sn)
+	}
+
+	a := Address(sn<<8 | family<<56)
+	crc := Crc8(a.Bytes()[:7])
 
 	if "--" != crcStr {
-		var c uint8
-		cnt, err = fmt.Sscanf(crcStr, "%x", &c)
-		if c != crc {
-			return 0, errors.New("onewire: invalid crc " + s)
+		c, err := strconv.ParseUint(crcStr, 16, 8)
+		if nil != err {
+			return 0, invalidAddress(s)
+		}
+		if byte(c) != crc {
+			return 0, &CRCError{Expected: uint16(crc), Actual: uint16(c)}
 		}
 	}
 
-	a |= 0xff & uint64(crc)
+	return a | Address(crc), nil
+}
 
-	return Address(a), nil
+func invalidAddress(s string) error {
+	return errors.New("onewire: invalid address " + s)
 }
 
 // Creates an Address from the canonical byte version.
@@ -84,7 +195,7 @@ func AddressFromBytes(buf []byte) (Address, error) {
 	}
 	crc := Crc8(buf[:7])
 	if buf[7] != crc {
-		return 0, errors.New("onewire: invalid crc")
+		return 0, &CRCError{Expected: uint16(crc), Actual: uint16(buf[7])}
 	}
 
 	return Address(binary.BigEndian.Uint64(buf)), nil
@@ -103,3 +214,68 @@ func AddressFromSearch(a uint64) (Address, error) {
 
 	return AddressFromBytes(buf)
 }
+
+// MarshalText provides the canonical string form of the address.
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText parses the address using ParseAddress.
+func (a *Address) UnmarshalText(text []byte) error {
+	v, err := ParseAddress(string(text))
+	if nil != err {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// MarshalJSON provides the canonical string form of the address as a JSON
+// string.
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON parses the address from a JSON string.  A JSON null leaves
+// the address unchanged.
+func (a *Address) UnmarshalJSON(data []byte) error {
+	if "null" == string(data) {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); nil != err {
+		return errors.New("onewire: invalid address " + string(data))
+	}
+	return a.UnmarshalText([]byte(s))
+}
+
+// Scan implements the sql.Scanner interface.  Strings and byte slices are
+// parsed using ParseAddress and integers are treated as the 64-bit ROM code.
+func (a *Address) Scan(src interface{}) error {
+	var v Address
+	var err error
+
+	switch src := src.(type) {
+	case string:
+		v, err = ParseAddress(src)
+	case []byte:
+		v, err = ParseAddress(string(src))
+	case int64:
+		v, err = AddressFromUint64(uint64(src))
+	default:
+		return fmt.Errorf("onewire: cannot scan %T into an address", src)
+	}
+	if nil != err {
+		return err
+	}
+
+	*a = v
+	return nil
+}
+
+// Value implements the driver.Valuer interface using the canonical string
+// form of the address.
+func (a Address) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -1,6 +1,8 @@
 package go1wire
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,7 +26,8 @@ func TestParseAddress(t *testing.T) {
 
 	// CRC does not match
 	a, err = ParseAddress("10.450736030800.09")
-	assert.Error(err)
+	assert.True(errors.Is(err, ErrCRC))
+	assert.Equal(&CRCError{Expected: 0xe7, Actual: 0x09}, err)
 	assert.Equal(Address(0), a)
 
 	// Invalid CRC character
@@ -76,3 +79,165 @@ func TestAddressFromUint64(t *testing.T) {
 		assert.Equal("10.450736030800.e7", a.String())
 	}
 }
+
+func TestAddressText(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := ParseAddress("10.450736030800.e7")
+
+	text, err := a.MarshalText()
+	assert.NoError(err)
+	assert.Equal("10.450736030800.e7", string(text))
+
+	var b Address
+	assert.NoError(b.UnmarshalText(text))
+	assert.Equal(a, b)
+
+	assert.True(errors.Is(b.UnmarshalText([]byte("10.450736030800.09")), ErrCRC))
+	assert.Error(b.UnmarshalText([]byte("nope")))
+	assert.Equal(a, b)
+}
+
+func TestAddressJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	type Sensor struct {
+		Address Address            `json:"address"`
+		Others  []Address          `json:"others,omitempty"`
+		ByAddr  map[Address]string `json:"by_addr,omitempty"`
+	}
+
+	a, _ := ParseAddress("10.450736030800.e7")
+	in := Sensor{
+		Address: a,
+		Others:  []Address{a},
+		ByAddr:  map[Address]string{a: "attic"},
+	}
+
+	buf, err := json.Marshal(in)
+	if assert.NoError(err) {
+		assert.Equal(`{"address":"10.450736030800.e7","others":["10.450736030800.e7"],"by_addr":{"10.450736030800.e7":"attic"}}`, string(buf))
+	}
+
+	var out Sensor
+	if assert.NoError(json.Unmarshal(buf, &out)) {
+		assert.Equal(in, out)
+	}
+
+	// null leaves the address alone
+	assert.NoError(json.Unmarshal([]byte(`{"address":null}`), &out))
+	assert.Equal(a, out.Address)
+
+	err = json.Unmarshal([]byte(`{"address":"10.450736030800.09"}`), &out)
+	assert.True(errors.Is(err, ErrCRC))
+	assert.Error(json.Unmarshal([]byte(`{"address":1234}`), &out))
+}
+
+func TestAddressSQL(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := ParseAddress("10.450736030800.e7")
+
+	v, err := a.Value()
+	assert.NoError(err)
+	assert.Equal("10.450736030800.e7", v)
+
+	var b Address
+	assert.NoError(b.Scan("10.450736030800.e7"))
+	assert.Equal(a, b)
+
+	b = 0
+	assert.NoError(b.Scan([]byte("10.450736030800.e7")))
+	assert.Equal(a, b)
+
+	b = 0
+	assert.NoError(b.Scan(int64(0x10450736030800e7)))
+	assert.Equal(a, b)
+
+	assert.True(errors.Is(b.Scan("10.450736030800.09"), ErrCRC))
+	assert.True(errors.Is(b.Scan(int64(0x1045073603080009)), ErrCRC))
+	assert.Error(b.Scan(nil))
+	assert.Error(b.Scan(1.5))
+	assert.Equal(a, b)
+}
+
+func TestParseAddressFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	expected, _ := ParseAddress("28.1c3b6a050000.72")
+
+	tests := []string{
+		"28.1c3b6a050000.72",
+		"28.1C3B6A050000.72",
+		"28.1C3B6A050000",
+		"28-0000056a3b1c",
+		"28-0000056A3B1C",
+		"281c3b6a05000072",
+		"720000056a3b1c28",
+		"281C3B6A050000",
+		" 28.1c3b6a050000.72\n",
+	}
+	for _, test := range tests {
+		a, err := ParseAddress(test)
+		if assert.NoError(err, test) {
+			assert.Equal(expected, a, test)
+		}
+	}
+
+	// CRC is validated where it is present
+	bad := []string{
+		"28.1C3B6A050000.73",
+		"281c3b6a05000073",
+		"730000056a3b1c28",
+	}
+	for _, test := range bad {
+		_, err := ParseAddress(test)
+		assert.True(errors.Is(err, ErrCRC), test)
+	}
+
+	invalid := []string{
+		"",
+		"28",
+		"28-1c-3b",
+		"28-rr",
+		"28.1c.3b.6a",
+		"281c3b6a0500007",
+		"281c3b6a050000zz",
+		"28.1c3b6a05000000",
+	}
+	for _, test := range invalid {
+		a, err := ParseAddress(test)
+		assert.Error(err, test)
+		assert.False(errors.Is(err, ErrCRC), test)
+		assert.Equal(Address(0), a, test)
+	}
+}
+
+func TestAddressFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := ParseAddress("28.1c3b6a050000.72")
+
+	tests := []struct {
+		format   AddressFormat
+		expected string
+	}{
+		{FormatCanonical, "28.1c3b6a050000.72"},
+		{FormatSysfs, "28-0000056a3b1c"},
+		{FormatOWFS, "28.1C3B6A050000"},
+		{FormatOWFSCRC, "28.1C3B6A050000.72"},
+		{FormatHex, "281c3b6a05000072"},
+		{FormatHexReversed, "720000056a3b1c28"},
+	}
+	for _, test := range tests {
+		s := a.Format(test.format)
+		assert.Equal(test.expected, s)
+
+		// Every format parses back to the same address
+		b, err := ParseAddress(s)
+		if assert.NoError(err, s) {
+			assert.Equal(a, b, s)
+		}
+	}
+	assert.Equal(a.String(), a.Format(FormatCanonical))
+}
@@ -0,0 +1,343 @@
+package go1wire
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ROM_READ            = 0x33
+	ROM_MATCH           = 0x55
+	ROM_SKIP            = 0xcc
+	ROM_RESUME          = 0xa5
+	ROM_OVERDRIVE_SKIP  = 0x3c
+	ROM_OVERDRIVE_MATCH = 0x69
+)
+
+// Speed is the communication speed of the bus.
+type Speed int
+
+const (
+	SpeedStandard Speed = iota
+	SpeedOverdrive
+)
+
+// A SpeedAdapter is an Adapter that is able to change the speed used to
+// communicate on the bus.
+type SpeedAdapter interface {
+	Adapter
+
+	// SetSpeed changes the speed used for all following operations.
+	SetSpeed(ctx context.Context, s Speed) error
+}
+
+// A Bus provides the ROM level commands used to select devices on top of an
+// Adapter.  Every ROM command starts with a reset of the bus.
+//
+// A Bus is safe to use from multiple goroutines.  Each method is performed
+// with exclusive access to the bus; use Do to perform a sequence of
+// operations (reset, select, I/O) without other goroutines interleaving.
+type Bus struct {
+	adapter    Adapter
+	observer   Observer
+	middleware []Middleware
+	overdrive  bool
+	lock       chan struct{}
+}
+
+// A Tx provides exclusive access to a Bus for the duration of the function
+// passed to Bus.Do.  It must not be used after that function returns.
+type Tx struct {
+	ctx           context.Context
+	bus           *Bus
+	nonIdempotent bool
+}
+
+// A TxFunc performs a transaction with exclusive access to the bus.
+type TxFunc func(tx *Tx) error
+
+// A Middleware wraps every transaction performed on a Bus, for example to
+// retry it.  The transaction is performed by calling next.
+type Middleware func(next TxFunc) TxFunc
+
+// NewBus creates a Bus using the adapter.  If the adapter is an Observer it
+// is used as the observer of the bus.
+func NewBus(a Adapter) *Bus {
+	o, _ := a.(Observer)
+	return &Bus{
+		adapter:  a,
+		observer: o,
+		lock:     make(chan struct{}, 1),
+	}
+}
+
+// Adapter returns the adapter the bus uses.
+func (b *Bus) Adapter() Adapter {
+	return b.adapter
+}
+
+// Do calls fn with exclusive access to the bus.  Waiting for access honors
+// the context, which is also used for every operation performed through the
+// Tx.  Calling Do (or any other Bus method) from inside fn will deadlock.
+func (b *Bus) Do(ctx context.Context, fn func(tx *Tx) error) error {
+	select {
+	case b.lock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-b.lock }()
+
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+
+	f := TxFunc(fn)
+	for i := len(b.middleware) - 1; 0 <= i; i-- {
+		f = b.middleware[i](f)
+	}
+
+	return f(&Tx{ctx: ctx, bus: b})
+}
+
+// Use adds middleware that wraps every transaction.  The first middleware
+// added is the outermost.  It must be called before the bus is used.
+func (b *Bus) Use(m ...Middleware) {
+	b.middleware = append(b.middleware, m...)
+}
+
+// Overdrive returns true if the bus is running at overdrive speed.
+func (b *Bus) Overdrive() bool {
+	var rv bool
+	b.Do(context.Background(), func(tx *Tx) error {
+		rv = tx.Overdrive()
+		return nil
+	})
+	return rv
+}
+
+// Reset resets the bus at the current speed.  If no device is present
+// ErrNoPresence is returned and if the bus is shorted ErrBusShorted.
+func (b *Bus) Reset(ctx context.Context) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.Reset() })
+}
+
+// Standard returns the bus and all the devices on it to standard speed.
+func (b *Bus) Standard(ctx context.Context) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.Standard() })
+}
+
+// Search returns the addresses of all the devices on the bus.
+func (b *Bus) Search(ctx context.Context) ([]Address, error) {
+	var list []Address
+	err := b.Do(ctx, func(tx *Tx) (err error) {
+		list, err = SearchContext(ctx, b.adapter)
+		return err
+	})
+	return list, err
+}
+
+// MatchROM selects the device with the address.
+func (b *Bus) MatchROM(ctx context.Context, a Address) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.MatchROM(a) })
+}
+
+// SkipROM selects all the devices on the bus.
+func (b *Bus) SkipROM(ctx context.Context) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.SkipROM() })
+}
+
+// ResumeROM selects the device that was most recently selected by a
+// MatchROM or search.  Only devices that support it will respond.
+func (b *Bus) ResumeROM(ctx context.Context) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.ResumeROM() })
+}
+
+// ReadROM returns the address of the device on the bus.  This only works if
+// there is a single device on the bus.
+func (b *Bus) ReadROM(ctx context.Context) (Address, error) {
+	var a Address
+	err := b.Do(ctx, func(tx *Tx) (err error) {
+		a, err = tx.ReadROM()
+		return err
+	})
+	return a, err
+}
+
+// OverdriveSkipROM switches all the devices on the bus to overdrive speed
+// and selects them.  The adapter must be a SpeedAdapter.
+func (b *Bus) OverdriveSkipROM(ctx context.Context) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.OverdriveSkipROM() })
+}
+
+// OverdriveMatchROM switches the device with the address to overdrive speed
+// and selects it.  The adapter must be a SpeedAdapter.
+func (b *Bus) OverdriveMatchROM(ctx context.Context, a Address) error {
+	return b.Do(ctx, func(tx *Tx) error { return tx.OverdriveMatchROM(a) })
+}
+
+// TxRx sends tx on the bus while filling rx with the bytes read back.
+func (b *Bus) TxRx(ctx context.Context, tx, rx []byte) error {
+	return b.Do(ctx, func(t *Tx) error { return t.TxRx(tx, rx) })
+}
+
+// Write sends tx on the bus ignoring the bytes read back.
+func (b *Bus) Write(ctx context.Context, tx []byte) error {
+	return b.Do(ctx, func(t *Tx) error { return t.Write(tx) })
+}
+
+// Context returns the context of the transaction.
+func (t *Tx) Context() context.Context {
+	return t.ctx
+}
+
+// Adapter returns the adapter of the bus for operations the Tx does not
+// provide.
+func (t *Tx) Adapter() Adapter {
+	return t.bus.adapter
+}
+
+// MarkNonIdempotent marks the transaction as one that must not be repeated,
+// such as one that writes to EEPROM.  Middleware that retries transactions
+// checks Idempotent.
+func (t *Tx) MarkNonIdempotent() {
+	t.nonIdempotent = true
+}
+
+// Idempotent returns false if the transaction has been marked as one that
+// must not be repeated.
+func (t *Tx) Idempotent() bool {
+	return !t.nonIdempotent
+}
+
+// Overdrive returns true if the bus is running at overdrive speed.
+func (t *Tx) Overdrive() bool {
+	return t.bus.overdrive
+}
+
+// Reset resets the bus at the current speed.  If no device is present
+// ErrNoPresence is returned and if the bus is shorted ErrBusShorted.
+func (t *Tx) Reset() error {
+	p, err := ResetContext(t.ctx, t.bus.adapter)
+	if nil != err {
+		return err
+	}
+	return p.Err()
+}
+
+// Standard returns the bus and all the devices on it to standard speed.
+func (t *Tx) Standard() error {
+	if err := t.setSpeed(SpeedStandard); nil != err {
+		return err
+	}
+	return t.Reset()
+}
+
+// MatchROM selects the device with the address.
+func (t *Tx) MatchROM(a Address) error {
+	return t.command(ROM_MATCH, a.Bytes()...)
+}
+
+// SkipROM selects all the devices on the bus.
+func (t *Tx) SkipROM() error {
+	return t.command(ROM_SKIP)
+}
+
+// ResumeROM selects the device that was most recently selected by a
+// MatchROM or search.  Only devices that support it will respond.
+func (t *Tx) ResumeROM() error {
+	return t.command(ROM_RESUME)
+}
+
+// ReadROM returns the address of the device on the bus.  This only works if
+// there is a single device on the bus.
+func (t *Tx) ReadROM() (Address, error) {
+	if err := t.Reset(); nil != err {
+		return 0, err
+	}
+
+	tx := []byte{ROM_READ, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	rx := make([]byte, len(tx))
+	if err := t.TxRx(tx, rx); nil != err {
+		return 0, err
+	}
+
+	return AddressFromBytes(rx[1:])
+}
+
+// OverdriveSkipROM switches all the devices on the bus to overdrive speed
+// and selects them.  The adapter must be a SpeedAdapter.
+func (t *Tx) OverdriveSkipROM() error {
+	if 0 == Capabilities(t.bus.adapter)&CapSpeed {
+		return ErrNotSupported
+	}
+	if err := t.Standard(); nil != err {
+		return err
+	}
+	if err := t.Write([]byte{ROM_OVERDRIVE_SKIP}); nil != err {
+		return err
+	}
+	return t.setSpeed(SpeedOverdrive)
+}
+
+// OverdriveMatchROM switches the device with the address to overdrive speed
+// and selects it.  The address is sent at overdrive speed.  The adapter must
+// be a SpeedAdapter.
+func (t *Tx) OverdriveMatchROM(a Address) error {
+	if 0 == Capabilities(t.bus.adapter)&CapSpeed {
+		return ErrNotSupported
+	}
+	if err := t.Standard(); nil != err {
+		return err
+	}
+	if err := t.Write([]byte{ROM_OVERDRIVE_MATCH}); nil != err {
+		return err
+	}
+	if err := t.setSpeed(SpeedOverdrive); nil != err {
+		return err
+	}
+	return t.Write(a.Bytes())
+}
+
+// TxRx sends tx on the bus while filling rx with the bytes read back.
+func (t *Tx) TxRx(tx, rx []byte) error {
+	return TxRxContext(t.ctx, t.bus.adapter, tx, rx)
+}
+
+// Write sends tx on the bus ignoring the bytes read back.
+func (t *Tx) Write(tx []byte) error {
+	return t.TxRx(tx, make([]byte, len(tx)))
+}
+
+// WriteBytePower writes the byte then holds the bus at the strong pull-up
+// for the duration so parasite powered devices have enough power to finish.
+// The adapter must be a PowerAdapter.
+func (t *Tx) WriteBytePower(b byte, d time.Duration) error {
+	if 0 == Capabilities(t.bus.adapter)&CapPower {
+		return ErrNotSupported
+	}
+	return t.bus.adapter.(PowerAdapter).WriteBytePower(t.ctx, b, d)
+}
+
+// command resets the bus and sends the ROM command with any arguments.
+func (t *Tx) command(cmd byte, args ...byte) error {
+	if err := t.Reset(); nil != err {
+		return err
+	}
+	return t.Write(append([]byte{cmd}, args...))
+}
+
+func (t *Tx) setSpeed(s Speed) error {
+	if SpeedStandard == s && !t.bus.overdrive {
+		return nil
+	}
+
+	if 0 == Capabilities(t.bus.adapter)&CapSpeed {
+		return ErrNotSupported
+	}
+	if err := t.bus.adapter.(SpeedAdapter).SetSpeed(t.ctx, s); nil != err {
+		return err
+	}
+
+	t.bus.overdrive = SpeedOverdrive == s
+	return nil
+}
@@ -0,0 +1,287 @@
+package go1wire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// logAdapter records the operations performed on it.
+type logAdapter struct {
+	log      []string
+	reply    []byte
+	presence PresenceResult
+}
+
+func (l *logAdapter) Detect() (bool, error) { return true, nil }
+func (l *logAdapter) Search() ([]Address, error) {
+	return nil, nil
+}
+
+func (l *logAdapter) Reset() (PresenceResult, error) {
+	l.log = append(l.log, "reset")
+	return l.presence, nil
+}
+
+func (l *logAdapter) TxRx(tx, rx []byte) error {
+	l.log = append(l.log, fmt.Sprintf("% x", tx))
+	copy(rx, l.reply)
+	return nil
+}
+
+type speedLogAdapter struct {
+	logAdapter
+}
+
+func (l *speedLogAdapter) SetSpeed(ctx context.Context, s Speed) error {
+	l.log = append(l.log, fmt.Sprintf("speed %d", s))
+	return nil
+}
+
+func TestBusRomCommands(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a, _ := ParseAddress("10.450736030800.e7")
+
+	l := &logAdapter{presence: PresenceDetected}
+	b := NewBus(l)
+	assert.Equal(l, b.Adapter())
+
+	assert.NoError(b.MatchROM(ctx, a))
+	assert.NoError(b.SkipROM(ctx))
+	assert.NoError(b.ResumeROM(ctx))
+	assert.Equal([]string{
+		"reset", "55 10 45 07 36 03 08 00 e7",
+		"reset", "cc",
+		"reset", "a5",
+	}, l.log)
+
+	assert.Equal(ErrNotSupported, b.OverdriveSkipROM(ctx))
+	assert.Equal(ErrNotSupported, b.OverdriveMatchROM(ctx, a))
+}
+
+func TestBusReadROM(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	l := &logAdapter{presence: PresenceDetected, reply: []byte{0x33, 0x10, 0x45, 0x07, 0x36, 0x03, 0x08, 0x00, 0xe7}}
+	b := NewBus(l)
+
+	a, err := b.ReadROM(ctx)
+	if assert.NoError(err) {
+		assert.Equal("10.450736030800.e7", a.String())
+	}
+	assert.Equal([]string{"reset", "33 ff ff ff ff ff ff ff ff"}, l.log)
+
+	// Multiple devices talking over each other
+	l.reply[8] = 0x00
+	_, err = b.ReadROM(ctx)
+	assert.Error(err)
+}
+
+func TestBusOverdrive(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a, _ := ParseAddress("10.450736030800.e7")
+
+	l := &speedLogAdapter{logAdapter{presence: PresenceDetected}}
+	b := NewBus(l)
+
+	assert.NoError(b.OverdriveSkipROM(ctx))
+	assert.True(b.Overdrive())
+	assert.NoError(b.SkipROM(ctx))
+	assert.NoError(b.OverdriveMatchROM(ctx, a))
+	assert.True(b.Overdrive())
+	assert.NoError(b.Standard(ctx))
+	assert.False(b.Overdrive())
+
+	assert.Equal([]string{
+		"reset", "3c", "speed 1",
+		"reset", "cc",
+		"speed 0", "reset", "69", "speed 1", "10 45 07 36 03 08 00 e7",
+		"speed 0", "reset",
+	}, l.log)
+}
+
+func TestBusDo(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	a, _ := ParseAddress("10.450736030800.e7")
+
+	l := &logAdapter{presence: PresenceDetected}
+	b := NewBus(l)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := b.Do(ctx, func(tx *Tx) error {
+				if err := tx.MatchROM(a); nil != err {
+					return err
+				}
+				return tx.Write([]byte{byte(i)})
+			})
+			assert.NoError(err)
+		}(i)
+	}
+	wg.Wait()
+
+	if assert.Len(l.log, 30) {
+		for i := 0; i < len(l.log); i += 3 {
+			assert.Equal("reset", l.log[i])
+			assert.Equal("55 10 45 07 36 03 08 00 e7", l.log[i+1])
+			assert.Len(l.log[i+2], 2)
+		}
+	}
+
+	// The error from the function is returned
+	failed := errors.New("failed")
+	assert.Equal(failed, b.Do(ctx, func(tx *Tx) error { return failed }))
+}
+
+func TestBusDoContext(t *testing.T) {
+	assert := assert.New(t)
+
+	b := NewBus(&logAdapter{presence: PresenceDetected})
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go b.Do(context.Background(), func(tx *Tx) error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+
+	// Waiting for the bus is bounded by the context
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	called := false
+	err := b.Do(ctx, func(tx *Tx) error {
+		called = true
+		return nil
+	})
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.False(called)
+
+	close(release)
+	assert.NoError(b.SkipROM(context.Background()))
+}
+
+func TestBusPresence(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	l := &logAdapter{presence: PresenceAlarming}
+	b := NewBus(l)
+	assert.NoError(b.SkipROM(ctx))
+
+	l.presence = PresenceNone
+	assert.Equal(ErrNoPresence, b.SkipROM(ctx))
+
+	l.presence = PresenceShorted
+	assert.Equal(ErrBusShorted, b.Reset(ctx))
+
+	// Nothing is sent after a failed reset
+	assert.Equal([]string{"reset", "cc", "reset", "reset"}, l.log)
+}
+
+type powerLogAdapter struct {
+	logAdapter
+}
+
+func (l *powerLogAdapter) WriteBytePower(ctx context.Context, b byte, d time.Duration) error {
+	l.log = append(l.log, fmt.Sprintf("power %02x %s", b, d))
+	return nil
+}
+
+func TestTxWriteBytePower(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	convert := func(tx *Tx) error {
+		if err := tx.SkipROM(); nil != err {
+			return err
+		}
+		return tx.WriteBytePower(0x44, time.Millisecond*750)
+	}
+
+	l := &powerLogAdapter{logAdapter{presence: PresenceDetected}}
+	assert.NoError(NewBus(l).Do(ctx, convert))
+	assert.Equal([]string{"reset", "cc", "power 44 750ms"}, l.log)
+
+	assert.Equal(ErrNotSupported, NewBus(&logAdapter{presence: PresenceDetected}).Do(ctx, convert))
+}
+
+type observerAdapter struct {
+	logAdapter
+	crc []Address
+}
+
+func (o *observerAdapter) CRCError(a Address) { o.crc = append(o.crc, a) }
+func (o *observerAdapter) Resync()            {}
+
+func TestBusObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	a, _ := ParseAddress("10.450736030800.e7")
+
+	// Nothing is observed by default
+	b := NewBus(&logAdapter{})
+	assert.NotNil(b.Observer())
+	b.Observer().CRCError(a)
+
+	// The adapter is used if it observes
+	o := &observerAdapter{}
+	b = NewBus(o)
+	b.Observer().CRCError(a)
+	assert.Equal([]Address{a}, o.crc)
+
+	other := &observerAdapter{}
+	b.SetObserver(other)
+	b.Observer().CRCError(a)
+	assert.Len(o.crc, 1)
+	assert.Equal([]Address{a}, other.crc)
+}
+
+func TestBusMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var order []string
+	wrap := func(name string) Middleware {
+		return func(next TxFunc) TxFunc {
+			return func(tx *Tx) error {
+				order = append(order, name)
+				return next(tx)
+			}
+		}
+	}
+
+	l := &logAdapter{presence: PresenceDetected}
+	b := NewBus(l)
+	b.Use(wrap("outer"), wrap("inner"))
+
+	assert.NoError(b.Do(ctx, func(tx *Tx) error {
+		order = append(order, "fn")
+		assert.True(tx.Idempotent())
+		tx.MarkNonIdempotent()
+		assert.False(tx.Idempotent())
+		return nil
+	}))
+	assert.Equal([]string{"outer", "inner", "fn"}, order)
+
+	// Every operation of the bus is a transaction
+	order = nil
+	assert.NoError(b.SkipROM(ctx))
+	assert.Equal([]string{"outer", "inner"}, order)
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/schmidtw/go1wire"
 	"github.com/schmidtw/go1wire/adapters/ds2480"
 	"github.com/schmidtw/go1wire/devices/ds18x20"
 )
@@ -35,29 +37,28 @@ func main() {
 	adapter.Open()
 	defer adapter.Close()
 	adapter.Detect()
+	bus := go1wire.NewBus(adapter)
+	ctx := context.Background()
 
-	tempSensors := []*ds18x20.Ds18x20{}
-	list, err := adapter.Search()
+	tempSensors := []go1wire.Thermometer{}
+	list, err := bus.Devices(ctx)
 	if nil != err {
 		fmt.Printf("Err: %s\n", err)
 	} else {
 		fmt.Printf("== Found =========================\n")
-		for i := 0; i < len(list); i++ {
-			t, _ := ds18x20.New(adapter, list[i])
-			if nil != t {
-				fmt.Println(t.String())
+		for _, d := range list {
+			fmt.Println(d.String())
+			if t, ok := d.(go1wire.Thermometer); ok {
 				tempSensors = append(tempSensors, t)
-			} else {
-				fmt.Printf("%s - Unknown\n", list[i].String())
 			}
 		}
 	}
 
-	ds18x20.ConvertAll(adapter)
+	ds18x20.ConvertAllContext(ctx, bus)
 
 	fmt.Printf("==================================\n")
 	for _, t := range tempSensors {
-		temp, _ := t.LastTemp()
+		temp, _ := t.LastTempContext(ctx)
 		fmt.Printf("%s - Temp: %f (C) %f (F)\n", t.String(), temp, temp*9/5+32.0)
 	}
 }
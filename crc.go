@@ -2,6 +2,10 @@
 
 package go1wire
 
+import (
+	"hash"
+)
+
 // crc8Table values come from Maxim / Dallas Semi AN27.
 var crc8Table = []byte{
 	0, 94, 188, 226, 97, 63, 221, 131, 194, 156, 126, 32, 163, 253, 31, 65,
@@ -21,9 +25,33 @@ var crc8Table = []byte{
 	233, 183, 85, 11, 136, 214, 52, 106, 43, 117, 151, 201, 74, 20, 246, 168,
 	116, 42, 200, 150, 21, 75, 169, 247, 182, 232, 10, 84, 215, 137, 107, 53}
 
+// crc16Table is built from the polynomial x^16 + x^15 + x^2 + 1 described in
+// Maxim / Dallas Semi AN27.
+var crc16Table = makeCrc16Table()
+
+func makeCrc16Table() []uint16 {
+	table := make([]uint16, 256)
+	for i := range table {
+		crc := uint16(i)
+		for j := 0; j < 8; j++ {
+			if 0 != 1&crc {
+				crc = (crc >> 1) ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
 // calcCrc is based on the Maxim / Dallas Semi AN27 description
 func Crc8(buf []byte) byte {
-	var crc byte
+	return UpdateCrc8(0, buf)
+}
+
+// UpdateCrc8 continues calculating the CRC8 from crc over buf.
+func UpdateCrc8(crc byte, buf []byte) byte {
 	for _, b := range buf {
 		crc = crc8Table[crc^b]
 	}
@@ -38,3 +66,125 @@ func RevCrc8(buf []byte) byte {
 	}
 	return crc
 }
+
+// Crc16 calculates the 1-wire CRC16 over buf.  Devices send the inverted
+// value of this CRC.
+func Crc16(buf []byte) uint16 {
+	return UpdateCrc16(0, buf)
+}
+
+// UpdateCrc16 continues calculating the CRC16 from crc over buf.
+func UpdateCrc16(crc uint16, buf []byte) uint16 {
+	for _, b := range buf {
+		crc = (crc >> 8) ^ crc16Table[0xff&(crc^uint16(b))]
+	}
+	return crc
+}
+
+// CheckCrc8 verifies the last byte of buf is the CRC8 of the rest of buf.
+// A *CRCError is returned if it is not.
+func CheckCrc8(buf []byte) error {
+	if len(buf) < 1 {
+		return ErrInvalidResponse
+	}
+	return checkCrc8(Crc8(buf[:len(buf)-1]), buf[len(buf)-1])
+}
+
+// CheckCrc16 verifies the last two bytes of buf are the inverted CRC16 of
+// the rest of buf, least significant byte first, as sent by devices.  A
+// *CRCError is returned if they are not.
+func CheckCrc16(buf []byte) error {
+	if len(buf) < 2 {
+		return ErrInvalidResponse
+	}
+	return checkCrc16(Crc16(buf[:len(buf)-2]), buf[len(buf)-2:])
+}
+
+// VerifyCrc8 verifies the CRC8 accumulated by the hash matches crc.  A
+// *CRCError is returned if it does not.
+func VerifyCrc8(h Hash8, crc byte) error {
+	return checkCrc8(h.Sum8(), crc)
+}
+
+// VerifyCrc16 verifies the CRC16 accumulated by the hash matches the two
+// inverted CRC bytes as sent by devices.  A *CRCError is returned if it does
+// not.
+func VerifyCrc16(h Hash16, crc []byte) error {
+	if len(crc) != 2 {
+		return ErrInvalidResponse
+	}
+	return checkCrc16(h.Sum16(), crc)
+}
+
+func checkCrc8(expected, actual byte) error {
+	if expected != actual {
+		return &CRCError{Expected: uint16(expected), Actual: uint16(actual)}
+	}
+	return nil
+}
+
+func checkCrc16(crc uint16, inverted []byte) error {
+	expected := ^crc
+	actual := uint16(inverted[0]) | uint16(inverted[1])<<8
+	if expected != actual {
+		return &CRCError{Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// Hash8 is a hash.Hash that calculates the 1-wire CRC8.
+type Hash8 interface {
+	hash.Hash
+	Sum8() byte
+}
+
+// Hash16 is a hash.Hash that calculates the 1-wire CRC16.  Sum appends the
+// inverted CRC16 least significant byte first, as devices send it on the bus;
+// Sum16 returns the CRC16 itself.
+type Hash16 interface {
+	hash.Hash
+	Sum16() uint16
+}
+
+type crc8Hash struct {
+	crc byte
+}
+
+// NewCrc8 creates a hash that calculates the 1-wire CRC8 as data is written.
+func NewCrc8() Hash8 {
+	return &crc8Hash{}
+}
+
+func (h *crc8Hash) Write(p []byte) (int, error) {
+	h.crc = UpdateCrc8(h.crc, p)
+	return len(p), nil
+}
+
+func (h *crc8Hash) Sum(b []byte) []byte { return append(b, h.crc) }
+func (h *crc8Hash) Sum8() byte          { return h.crc }
+func (h *crc8Hash) Reset()              { h.crc = 0 }
+func (h *crc8Hash) Size() int           { return 1 }
+func (h *crc8Hash) BlockSize() int      { return 1 }
+
+type crc16Hash struct {
+	crc uint16
+}
+
+// NewCrc16 creates a hash that calculates the 1-wire CRC16 as data is
+// written.
+func NewCrc16() Hash16 {
+	return &crc16Hash{}
+}
+
+func (h *crc16Hash) Write(p []byte) (int, error) {
+	h.crc = UpdateCrc16(h.crc, p)
+	return len(p), nil
+}
+
+func (h *crc16Hash) Sum(b []byte) []byte {
+	return append(b, ^byte(h.crc), ^byte(h.crc>>8))
+}
+func (h *crc16Hash) Sum16() uint16  { return h.crc }
+func (h *crc16Hash) Reset()         { h.crc = 0 }
+func (h *crc16Hash) Size() int      { return 2 }
+func (h *crc16Hash) BlockSize() int { return 1 }
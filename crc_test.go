@@ -0,0 +1,72 @@
+package go1wire
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrc8(t *testing.T) {
+	assert := assert.New(t)
+
+	rom := []byte{0x10, 0x45, 0x07, 0x36, 0x03, 0x08, 0x00, 0xe7}
+	assert.Equal(byte(0xe7), Crc8(rom[:7]))
+	assert.Equal(byte(0), Crc8(rom))
+	assert.Equal(byte(0xe7), UpdateCrc8(Crc8(rom[:3]), rom[3:7]))
+
+	assert.NoError(CheckCrc8(rom))
+	rom[7] = 0x01
+	err := CheckCrc8(rom)
+	assert.True(errors.Is(err, ErrCRC))
+	assert.Equal(&CRCError{Expected: 0xe7, Actual: 0x01}, err)
+	assert.Equal(ErrInvalidResponse, CheckCrc8(nil))
+}
+
+func TestCrc16(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte("123456789")
+	assert.Equal(uint16(0xbb3d), Crc16(data))
+	assert.Equal(uint16(0xbb3d), UpdateCrc16(Crc16(data[:4]), data[4:]))
+
+	// Devices send the inverted CRC, least significant byte first
+	buf := append(data, 0xc2, 0x44)
+	assert.NoError(CheckCrc16(buf))
+
+	buf[len(buf)-1] = 0x00
+	err := CheckCrc16(buf)
+	assert.True(errors.Is(err, ErrCRC))
+	assert.Equal(&CRCError{Expected: 0x44c2, Actual: 0x00c2}, err)
+	assert.Equal(ErrInvalidResponse, CheckCrc16([]byte{0x00}))
+}
+
+func TestCrcHash(t *testing.T) {
+	assert := assert.New(t)
+
+	h8 := NewCrc8()
+	h8.Write([]byte{0x10, 0x45, 0x07})
+	h8.Write([]byte{0x36, 0x03, 0x08, 0x00})
+	assert.Equal(byte(0xe7), h8.Sum8())
+	assert.Equal([]byte{0xaa, 0xe7}, h8.Sum([]byte{0xaa}))
+	assert.Equal(1, h8.Size())
+	assert.Equal(1, h8.BlockSize())
+	assert.NoError(VerifyCrc8(h8, 0xe7))
+	assert.True(errors.Is(VerifyCrc8(h8, 0xe6), ErrCRC))
+	h8.Reset()
+	assert.Equal(byte(0), h8.Sum8())
+
+	h16 := NewCrc16()
+	h16.Write([]byte("1234"))
+	h16.Write([]byte("56789"))
+	assert.Equal(uint16(0xbb3d), h16.Sum16())
+	assert.Equal([]byte{0xc2, 0x44}, h16.Sum(nil))
+	assert.NoError(CheckCrc16(h16.Sum([]byte("123456789"))))
+	assert.Equal(2, h16.Size())
+	assert.Equal(1, h16.BlockSize())
+	assert.NoError(VerifyCrc16(h16, []byte{0xc2, 0x44}))
+	assert.True(errors.Is(VerifyCrc16(h16, []byte{0x44, 0xc2}), ErrCRC))
+	assert.Equal(ErrInvalidResponse, VerifyCrc16(h16, nil))
+	h16.Reset()
+	assert.Equal(uint16(0), h16.Sum16())
+}
@@ -1,8 +1,9 @@
 package ds18x20
 
 import (
-	//"encoding/hex"
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/schmidtw/go1wire"
@@ -13,38 +14,191 @@ const (
 	CMD_READ_SCRATCHPAD   = 0xbe
 	CMD_WRITE_SCRATCHPAD  = 0x4e
 	CMD_COPY_SCRATCHPAD   = 0x48
+	CMD_RECALL_E2         = 0xb8
 	CMD_READ_POWER_SUPPLY = 0xb4
 
 	FAMILY_DS18S20 = 0x10
 	FAMILY_DS18B20 = 0x28
 )
 
+// The worst case times from the datasheets.
+const (
+	convertTime = time.Millisecond * 750
+	copyTime    = time.Millisecond * 10
+)
+
 type Ds18x20 struct {
 	address go1wire.Address
-	net     go1wire.Adapter
+	bus     *go1wire.Bus
+
+	mu         sync.Mutex
+	powerKnown bool
+	parasite   bool
+}
+
+var _ go1wire.Thermometer = (*Ds18x20)(nil)
+
+var functions = map[byte]go1wire.Function{
+	CMD_CONVERT_T:         {Name: "CONVERT T"},
+	CMD_READ_SCRATCHPAD:   {Name: "READ SCRATCHPAD", CRC: go1wire.CRC8},
+	CMD_WRITE_SCRATCHPAD:  {Name: "WRITE SCRATCHPAD"},
+	CMD_COPY_SCRATCHPAD:   {Name: "COPY SCRATCHPAD"},
+	CMD_RECALL_E2:         {Name: "RECALL E2"},
+	CMD_READ_POWER_SUPPLY: {Name: "READ POWER SUPPLY"},
+}
+
+func init() {
+	for _, code := range []byte{FAMILY_DS18S20, FAMILY_DS18B20} {
+		go1wire.RegisterFamily(go1wire.Family{
+			Code: code,
+			New: func(bus *go1wire.Bus, addr go1wire.Address) (go1wire.Device, error) {
+				d, err := New(bus, addr)
+				if nil != err {
+					return nil, err
+				}
+				return d, nil
+			},
+			Functions: functions,
+		})
+	}
 }
 
-func New(adapter go1wire.Adapter, addr go1wire.Address) (*Ds18x20, error) {
+func New(bus *go1wire.Bus, addr go1wire.Address) (*Ds18x20, error) {
 	if FAMILY_DS18S20 != addr.Family() &&
 		FAMILY_DS18B20 != addr.Family() {
 		return nil, fmt.Errorf("Not the right kind of device.")
 	}
 	d := &Ds18x20{
-		net:     adapter,
+		bus:     bus,
 		address: addr,
 	}
 
 	return d, nil
 }
 
-func ConvertAll(net go1wire.Adapter) {
-	net.Reset()
-	net.TxRx([]byte{0xcc, 0x44}, nil)
-	time.Sleep(time.Millisecond * 750)
+func ConvertAll(bus *go1wire.Bus) {
+	ConvertAllContext(context.Background(), bus)
 
 	return
 }
 
+// ConvertAllContext starts a temperature conversion on all the devices on
+// the bus and waits for it to complete.  If any device is parasite powered
+// the bus is held at the strong pull-up for the whole conversion.
+func ConvertAllContext(ctx context.Context, bus *go1wire.Bus) error {
+	var parasite bool
+	err := bus.Do(ctx, func(tx *go1wire.Tx) (err error) {
+		if err = tx.SkipROM(); nil != err {
+			return err
+		}
+		parasite, err = readPowerSupply(tx)
+		return err
+	})
+	if nil != err {
+		return err
+	}
+
+	return command(ctx, bus, CMD_CONVERT_T, convertTime, parasite,
+		func(tx *go1wire.Tx) error { return tx.SkipROM() })
+}
+
+// command sends the function command to the selected devices then waits
+// for the duration.  If parasite is set the bus is held at the strong pull-up
+// while waiting, otherwise the bus is released for others to use.
+func command(ctx context.Context, bus *go1wire.Bus, cmd byte, wait time.Duration,
+	parasite bool, sel func(*go1wire.Tx) error) error {
+	err := bus.Do(ctx, func(tx *go1wire.Tx) error {
+		if CMD_COPY_SCRATCHPAD == cmd {
+			tx.MarkNonIdempotent()
+		}
+		if err := sel(tx); nil != err {
+			return err
+		}
+		if parasite {
+			return tx.WriteBytePower(cmd, wait)
+		}
+		return tx.Write([]byte{cmd})
+	})
+	if nil != err || parasite {
+		return err
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+
+	return nil
+}
+
+// readPowerSupply asks the selected devices if any are parasite powered.
+// Parasite powered devices pull the bus low during the read slot.
+func readPowerSupply(tx *go1wire.Tx) (bool, error) {
+	rx := make([]byte, 2)
+	if err := tx.TxRx([]byte{CMD_READ_POWER_SUPPLY, 0xff}, rx); nil != err {
+		return false, err
+	}
+	return 0 == 0x01&rx[1], nil
+}
+
+// Parasite returns true if the device is parasite powered.  The answer is
+// remembered after the first successful check.
+func (d *Ds18x20) Parasite(ctx context.Context) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.powerKnown {
+		return d.parasite, nil
+	}
+
+	err := d.bus.Do(ctx, func(tx *go1wire.Tx) (err error) {
+		if err = tx.MatchROM(d.address); nil != err {
+			return err
+		}
+		d.parasite, err = readPowerSupply(tx)
+		return err
+	})
+	if nil != err {
+		return false, err
+	}
+	d.powerKnown = true
+
+	return d.parasite, nil
+}
+
+// Convert starts a temperature conversion on the device and waits for it to
+// complete.
+func (d *Ds18x20) Convert(ctx context.Context) error {
+	parasite, err := d.Parasite(ctx)
+	if nil != err {
+		return err
+	}
+
+	return command(ctx, d.bus, CMD_CONVERT_T, convertTime, parasite,
+		func(tx *go1wire.Tx) error { return tx.MatchROM(d.address) })
+}
+
+// CopyScratchPad copies the TH, TL (and configuration on a DS18B20) registers
+// into the device's EEPROM.
+func (d *Ds18x20) CopyScratchPad(ctx context.Context) error {
+	parasite, err := d.Parasite(ctx)
+	if nil != err {
+		return err
+	}
+
+	return command(ctx, d.bus, CMD_COPY_SCRATCHPAD, copyTime, parasite,
+		func(tx *go1wire.Tx) error { return tx.MatchROM(d.address) })
+}
+
+// Address returns the address of the device.
+func (d *Ds18x20) Address() go1wire.Address {
+	return d.address
+}
+
 func (d *Ds18x20) String() string {
 	family := "ds18s20"
 	if FAMILY_DS18B20 == d.address.Family() {
@@ -53,25 +207,31 @@ func (d *Ds18x20) String() string {
 	return d.address.String() + " - " + family
 }
 
-func (d *Ds18x20) readScratchPad() ([]byte, error) {
-	addr := append([]byte{0x55}, d.address.Bytes()...)
-	cmd := []byte{CMD_READ_SCRATCHPAD,
+func (d *Ds18x20) readScratchPad(ctx context.Context) ([]byte, error) {
+	tx := []byte{CMD_READ_SCRATCHPAD,
 		0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff,
 		0xff, 0xff, 0xff}
-	tx := append(addr, cmd...)
 	rx := make([]byte, len(tx))
 
-	d.net.Reset()
-	//fmt.Printf("tx:\n%s\n", hex.Dump(tx))
-	if err := d.net.TxRx(tx, rx); nil != err {
-		return nil, err
-	}
-	//fmt.Printf("rx:\n%s\n", hex.Dump(rx))
-
 	data := rx[len(rx)-9:]
-	if data[8] != go1wire.Crc8(data[:8]) {
-		return nil, fmt.Errorf("CRC didn't match")
+
+	// The CRC is checked as part of the transaction so it can be retried.
+	err := d.bus.Do(ctx, func(t *go1wire.Tx) error {
+		if err := t.MatchROM(d.address); nil != err {
+			return err
+		}
+		if err := t.TxRx(tx, rx); nil != err {
+			return err
+		}
+		if err := go1wire.CheckCrc8(data); nil != err {
+			d.bus.Observer().CRCError(d.address)
+			return err
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, err
 	}
 
 	return data, nil
@@ -79,23 +239,26 @@ func (d *Ds18x20) readScratchPad() ([]byte, error) {
 
 // Returns the last measured temperature in degrees C
 func (d *Ds18x20) LastTemp() (float64, error) {
-	buf, err := d.readScratchPad()
+	return d.LastTempContext(context.Background())
+}
+
+// Returns the last measured temperature in degrees C
+func (d *Ds18x20) LastTempContext(ctx context.Context) (float64, error) {
+	buf, err := d.readScratchPad(ctx)
 	if nil != err {
 		return 0.0, err
 	}
 
+	raw := int16(buf[1])<<8 | int16(buf[0])
 	lsb := 0.5
 	if FAMILY_DS18B20 == d.address.Family() {
-		switch 0x03 & (buf[4] >> 5) {
-		case 1:
-			lsb = 0.25
-		case 2:
-			lsb = 0.125
-		case 3:
-			lsb = 0.0625
-		}
+		// The scale is the same at every resolution, but the low bits are
+		// undefined below 12 bits.
+		undefined := 3 - uint(0x03&(buf[4]>>5))
+		raw &^= (1 << undefined) - 1
+		lsb = 0.0625
 	}
-	rv := float64(int(int8(buf[1]))<<8+int(buf[0])) * lsb
+	rv := float64(raw) * lsb
 
 	return rv, nil
 }
@@ -0,0 +1,248 @@
+package ds18x20
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/record"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(t *testing.T, s string) go1wire.Address {
+	a, err := go1wire.ParseAddress(s)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestNew(t *testing.T) {
+	assert := assert.New(t)
+
+	bus := go1wire.NewBus(sim.NewBus())
+
+	d, err := New(bus, mustParse(t, "28.000000000001.--"))
+	if assert.NoError(err) {
+		assert.Equal("28.000000000001.40 - ds18b20", d.String())
+	}
+
+	d, err = New(bus, mustParse(t, "10.450736030800.e7"))
+	if assert.NoError(err) {
+		assert.Equal("10.450736030800.e7 - ds18s20", d.String())
+	}
+
+	_, err = New(bus, mustParse(t, "01.4507360308ff.--"))
+	assert.Error(err)
+}
+
+func TestConvertAll(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s20 := sim.NewDS18S20(mustParse(t, "10.450736030800.e7"))
+	b20 := sim.NewDS18B20(mustParse(t, "28.000000000001.--"))
+	s20.SetTemp(21.5)
+	b20.SetTemp(-10.125)
+
+	bus := go1wire.NewBus(sim.NewBus(s20.Device, b20.Device))
+
+	therms, err := bus.Thermometers(ctx)
+	if !assert.NoError(err) || !assert.Len(therms, 2) {
+		return
+	}
+
+	// Nothing converted yet
+	for _, therm := range therms {
+		temp, err := therm.LastTempContext(ctx)
+		assert.NoError(err)
+		assert.Equal(85.0, temp)
+	}
+
+	assert.NoError(ConvertAllContext(ctx, bus))
+
+	for _, therm := range therms {
+		temp, err := therm.LastTempContext(ctx)
+		assert.NoError(err)
+		switch therm.Address() {
+		case s20.Device.Address():
+			assert.Equal(21.5, temp)
+		case b20.Device.Address():
+			assert.Equal(-10.125, temp)
+		}
+	}
+}
+
+func TestParasite(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	b20 := sim.NewDS18B20(mustParse(t, "28.000000000001.--"))
+	b20.SetParasite(true)
+	b20.SetTemp(23.0625)
+
+	bus := go1wire.NewBus(sim.NewBus(b20.Device))
+	d, err := New(bus, b20.Device.Address())
+	if !assert.NoError(err) {
+		return
+	}
+
+	parasite, err := d.Parasite(ctx)
+	assert.NoError(err)
+	assert.True(parasite)
+
+	// The conversion only finishes with the strong pull-up
+	assert.NoError(d.Convert(ctx))
+	temp, err := d.LastTempContext(ctx)
+	assert.NoError(err)
+	assert.Equal(23.0625, temp)
+
+	b20.SetTemp(-1.5)
+	assert.NoError(ConvertAllContext(ctx, bus))
+	temp, err = d.LastTempContext(ctx)
+	assert.NoError(err)
+	assert.Equal(-1.5, temp)
+}
+
+func TestResolution(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	b20 := sim.NewDS18B20(mustParse(t, "28.000000000001.--"))
+	b20.SetParasite(true)
+	b20.SetTemp(25.5625)
+
+	bus := go1wire.NewBus(sim.NewBus(b20.Device))
+	d, err := New(bus, b20.Device.Address())
+	if !assert.NoError(err) {
+		return
+	}
+
+	// 9-bit resolution then save it
+	assert.NoError(bus.MatchROM(ctx, d.Address()))
+	assert.NoError(bus.Write(ctx, []byte{CMD_WRITE_SCRATCHPAD, 0x4b, 0x46, 0x1f}))
+	assert.NoError(d.CopyScratchPad(ctx))
+	assert.Equal([]byte{0x4b, 0x46, 0x1f}, b20.EEPROM())
+
+	// The undefined low bits are ignored
+	assert.NoError(d.Convert(ctx))
+	temp, err := d.LastTempContext(ctx)
+	assert.NoError(err)
+	assert.Equal(25.5, temp)
+
+	b20.SetTemp(-10.1875)
+	assert.NoError(d.Convert(ctx))
+	temp, err = d.LastTempContext(ctx)
+	assert.NoError(err)
+	assert.Equal(-10.0, temp)
+}
+
+// scratchPad is a device that answers READ SCRATCHPAD with fixed bytes.
+type scratchPad struct {
+	data []byte
+	out  []byte
+}
+
+func (s *scratchPad) Reset() { s.out = nil }
+
+func (s *scratchPad) In(b byte) {
+	if nil == s.out && CMD_READ_SCRATCHPAD == b {
+		s.out = s.data
+	}
+}
+
+func (s *scratchPad) Out() byte {
+	if 0 == len(s.out) {
+		return 0xff
+	}
+	b := s.out[0]
+	s.out = s.out[1:]
+	return b
+}
+
+func TestLowResolutionReadings(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// The readings from the DS18B20 datasheet with the undefined bits set
+	tests := []struct {
+		lsb, msb, config byte
+		temp             float64
+	}{
+		{lsb: 0x91, msb: 0x01, config: 0x7f, temp: 25.0625},
+		{lsb: 0x6f, msb: 0xfe, config: 0x5f, temp: -25.125},
+		{lsb: 0x91, msb: 0x01, config: 0x3f, temp: 25.0},
+		{lsb: 0xa2, msb: 0x00, config: 0x1f, temp: 10.0},
+		{lsb: 0x5e, msb: 0xff, config: 0x1f, temp: -10.5},
+	}
+
+	a := mustParse(t, "28.000000000001.--")
+	for _, test := range tests {
+		data := []byte{test.lsb, test.msb, 0x4b, 0x46, test.config, 0xff, 0x0f, 0x10}
+		data = append(data, go1wire.Crc8(data))
+
+		bus := go1wire.NewBus(sim.NewBus(sim.NewDevice(a, &scratchPad{data: data})))
+		d, err := New(bus, a)
+		if !assert.NoError(err) {
+			return
+		}
+		temp, err := d.LastTempContext(ctx)
+		assert.NoError(err)
+		assert.Equal(test.temp, temp)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	b20 := sim.NewDS18B20(mustParse(t, "28.000000000001.--"))
+	other := sim.NewDevice(mustParse(t, "01.4507360308ff.--"), nil)
+	bus := go1wire.NewBus(sim.NewBus(other))
+
+	d, err := New(bus, b20.Device.Address())
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Nobody answers so the CRC does not match
+	_, err = d.LastTempContext(ctx)
+	assert.True(errors.Is(err, go1wire.ErrCRC))
+}
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	f, err := os.Open("testdata/convert.jsonl")
+	if !assert.NoError(err) {
+		return
+	}
+	defer f.Close()
+
+	play, err := record.NewReplayer(f)
+	if !assert.NoError(err) {
+		return
+	}
+	bus := go1wire.NewBus(play)
+
+	therms, err := bus.Thermometers(ctx)
+	if !assert.NoError(err) || !assert.Len(therms, 2) {
+		return
+	}
+	assert.NoError(ConvertAllContext(ctx, bus))
+
+	expected := map[string]float64{
+		"10.450736030800.e7": 21.5,
+		"28.000000000001.40": -10.125,
+	}
+	for _, therm := range therms {
+		temp, err := therm.LastTempContext(ctx)
+		assert.NoError(err)
+		assert.Equal(expected[therm.Address().String()], temp)
+	}
+	assert.Equal(0, play.Remaining())
+}
@@ -0,0 +1,75 @@
+package go1wire
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotSupported    = errors.New("onewire: operation not supported by adapter")
+	ErrNoPresence      = errors.New("onewire: no presence pulse detected")
+	ErrBusShorted      = errors.New("onewire: bus shorted")
+	ErrInvalidResponse = errors.New("onewire: invalid response")
+	ErrCRC             = errors.New("onewire: crc mismatch")
+	ErrNoDriver        = errors.New("onewire: no driver registered for family")
+)
+
+// A CRCError is returned when the CRC received does not match the CRC
+// calculated from the data.  errors.Is(err, ErrCRC) is true for a CRCError.
+type CRCError struct {
+	Expected uint16 // The CRC calculated from the data.
+	Actual   uint16 // The CRC received.
+}
+
+func (e *CRCError) Error() string {
+	return fmt.Sprintf("onewire: crc mismatch expected 0x%02x got 0x%02x", e.Expected, e.Actual)
+}
+
+// Is makes the CRCError match ErrCRC.
+func (e *CRCError) Is(target error) bool {
+	return ErrCRC == target
+}
+
+// A TimeoutError is returned by a read that passed its deadline.  Like a
+// net.Conn timeout it has a Timeout method that returns true.
+type TimeoutError struct{}
+
+func (TimeoutError) Error() string   { return "onewire: read timeout" }
+func (TimeoutError) Timeout() bool   { return true }
+func (TimeoutError) Temporary() bool { return true }
+
+// PresenceResult describes what was seen on the bus after a reset.
+type PresenceResult int
+
+const (
+	PresenceNone     PresenceResult = iota // No device responded
+	PresenceDetected                       // At least one device responded
+	PresenceAlarming                       // A device responded with an alarming presence pulse
+	PresenceShorted                        // The bus is shorted
+)
+
+func (p PresenceResult) String() string {
+	switch p {
+	case PresenceNone:
+		return "none"
+	case PresenceDetected:
+		return "detected"
+	case PresenceAlarming:
+		return "alarming"
+	case PresenceShorted:
+		return "shorted"
+	}
+	return fmt.Sprintf("PresenceResult(%d)", int(p))
+}
+
+// Err provides the error that matches the result or nil if a device is
+// present.
+func (p PresenceResult) Err() error {
+	switch p {
+	case PresenceDetected, PresenceAlarming:
+		return nil
+	case PresenceShorted:
+		return ErrBusShorted
+	}
+	return ErrNoPresence
+}
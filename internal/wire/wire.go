@@ -0,0 +1,22 @@
+// Package wire holds the helpers shared by the adapter middleware to keep
+// copies of the traffic they pass on.
+package wire
+
+// Copy returns a copy of b, or nil if b is empty.
+func Copy(b []byte) []byte {
+	if 0 == len(b) {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// Bits returns the bits as bytes of 0 or 1.
+func Bits(list ...bool) []byte {
+	rv := make([]byte, len(list))
+	for i, b := range list {
+		if b {
+			rv[i] = 1
+		}
+	}
+	return rv
+}
@@ -1,10 +1,206 @@
 package go1wire
 
-import ()
+import (
+	"context"
+	"time"
+)
 
 type Adapter interface {
 	Detect() (bool, error)
-	Reset() (string, byte, error)
+	Reset() (PresenceResult, error)
 	Search() ([]Address, error)
 	TxRx(tx, rx []byte) error
 }
+
+// A ContextAdapter is an Adapter that is able to bound its operations by a
+// context.  If the context is cancelled or the deadline passes while waiting
+// on the hardware the operation returns the context's error.
+type ContextAdapter interface {
+	Adapter
+
+	DetectContext(ctx context.Context) (bool, error)
+	ResetContext(ctx context.Context) (PresenceResult, error)
+	SearchContext(ctx context.Context) ([]Address, error)
+	TxRxContext(ctx context.Context, tx, rx []byte) error
+}
+
+// DetectContext detects the adapter using the context if the adapter is a
+// ContextAdapter.  Otherwise the context is only checked before starting.
+func DetectContext(ctx context.Context, a Adapter) (bool, error) {
+	if c, ok := a.(ContextAdapter); ok {
+		return c.DetectContext(ctx)
+	}
+	if err := ctx.Err(); nil != err {
+		return false, err
+	}
+	return a.Detect()
+}
+
+// ResetContext resets the bus using the context if the adapter is a
+// ContextAdapter.  Otherwise the context is only checked before starting.
+func ResetContext(ctx context.Context, a Adapter) (PresenceResult, error) {
+	if c, ok := a.(ContextAdapter); ok {
+		return c.ResetContext(ctx)
+	}
+	if err := ctx.Err(); nil != err {
+		return PresenceNone, err
+	}
+	return a.Reset()
+}
+
+// SearchContext searches the bus using the context if the adapter is a
+// ContextAdapter.  Otherwise the context is only checked before starting.
+func SearchContext(ctx context.Context, a Adapter) ([]Address, error) {
+	if c, ok := a.(ContextAdapter); ok {
+		return c.SearchContext(ctx)
+	}
+	if err := ctx.Err(); nil != err {
+		return nil, err
+	}
+	return a.Search()
+}
+
+// TxRxContext exchanges bytes on the bus using the context if the adapter is
+// a ContextAdapter.  Otherwise the context is only checked before starting.
+func TxRxContext(ctx context.Context, a Adapter, tx, rx []byte) error {
+	if c, ok := a.(ContextAdapter); ok {
+		return c.TxRxContext(ctx, tx, rx)
+	}
+	if err := ctx.Err(); nil != err {
+		return err
+	}
+	return a.TxRx(tx, rx)
+}
+
+// A BitAdapter is an Adapter that is able to generate individual time slots
+// on the bus.
+type BitAdapter interface {
+	Adapter
+
+	// TouchBit generates a single time slot writing the bit and returns the
+	// value sampled from the bus.  Writing a 1 is the same as a read slot.
+	TouchBit(ctx context.Context, bit bool) (bool, error)
+
+	// ReadBit generates a read time slot and returns the sampled value.
+	ReadBit(ctx context.Context) (bool, error)
+
+	// WriteBit generates a write time slot with the specified value.
+	WriteBit(ctx context.Context, bit bool) error
+}
+
+// A TripletAdapter is an Adapter that is able to perform the search triplet
+// (read the id bit, read the complement bit, write the direction) itself.
+type TripletAdapter interface {
+	Adapter
+
+	// Triplet reads the id bit and complement bit from the bus then writes
+	// the direction taken.  dir is only used if both values read are 0
+	// (there is a discrepancy), otherwise the id bit is taken.
+	Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error)
+}
+
+// A PowerAdapter is an Adapter that is able to power parasite powered
+// devices with a strong pull-up.
+type PowerAdapter interface {
+	Adapter
+
+	// WriteBytePower writes the byte then holds the bus at the strong
+	// pull-up for the duration before returning the bus to normal.  The
+	// pull-up is removed even if the context is cancelled.
+	WriteBytePower(ctx context.Context, b byte, d time.Duration) error
+}
+
+// Triplet performs the search triplet using the best primitive the adapter
+// provides.  If the adapter provides neither the triplet or single bit
+// operations ErrNotSupported is returned.
+func Triplet(ctx context.Context, a Adapter, dir bool) (id, cmp, taken bool, err error) {
+	caps := Capabilities(a)
+	if t, ok := a.(TripletAdapter); ok && 0 != caps&CapTriplet {
+		return t.Triplet(ctx, dir)
+	}
+	if 0 == caps&CapBit {
+		return false, false, false, ErrNotSupported
+	}
+	b := a.(BitAdapter)
+
+	if id, err = b.ReadBit(ctx); nil != err {
+		return false, false, false, err
+	}
+	if cmp, err = b.ReadBit(ctx); nil != err {
+		return false, false, false, err
+	}
+
+	switch {
+	case id && cmp:
+		// Nobody responded, write a 1 to keep the bus consistent.
+		taken = true
+	case id != cmp:
+		taken = id
+	default:
+		taken = dir
+	}
+
+	if err = b.WriteBit(ctx, taken); nil != err {
+		return false, false, false, err
+	}
+
+	return id, cmp, taken, nil
+}
+
+// A Capability is a set of the optional operations an adapter supports.
+type Capability uint
+
+const (
+	CapBit        Capability = 1 << iota // BitAdapter
+	CapTriplet                           // TripletAdapter or CapBit
+	CapSearchPass                        // SearchAccelerator
+	CapSpeed                             // SpeedAdapter
+	CapPower                             // PowerAdapter
+)
+
+// A CapabilityReporter is an Adapter that implements optional interfaces it
+// may not support, such as a middleware that wraps any adapter.  Capabilities
+// returns the operations that actually work.
+type CapabilityReporter interface {
+	Adapter
+
+	Capabilities() Capability
+}
+
+// Capabilities returns the optional operations the adapter supports.  If the
+// adapter is a CapabilityReporter it is asked, otherwise the interfaces it
+// implements are used.  CapTriplet is included with CapBit since Triplet is
+// performed with the bit operations.
+func Capabilities(a Adapter) Capability {
+	var rv Capability
+	if r, ok := a.(CapabilityReporter); ok {
+		rv = r.Capabilities()
+	} else {
+		rv = implemented(a)
+	}
+	if 0 != rv&CapBit {
+		rv |= CapTriplet
+	}
+	return rv
+}
+
+// implemented returns the optional interfaces the adapter implements.
+func implemented(a Adapter) Capability {
+	var rv Capability
+	if _, ok := a.(BitAdapter); ok {
+		rv |= CapBit
+	}
+	if _, ok := a.(TripletAdapter); ok {
+		rv |= CapTriplet
+	}
+	if _, ok := a.(SearchAccelerator); ok {
+		rv |= CapSearchPass
+	}
+	if _, ok := a.(SpeedAdapter); ok {
+		rv |= CapSpeed
+	}
+	if _, ok := a.(PowerAdapter); ok {
+		rv |= CapPower
+	}
+	return rv
+}
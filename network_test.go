@@ -0,0 +1,115 @@
+package go1wire
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bitAdapter struct {
+	reads  []bool
+	writes []bool
+}
+
+func (b *bitAdapter) Detect() (bool, error)          { return true, nil }
+func (b *bitAdapter) Reset() (PresenceResult, error) { return PresenceDetected, nil }
+func (b *bitAdapter) Search() ([]Address, error)     { return nil, nil }
+func (b *bitAdapter) TxRx(tx, rx []byte) error       { return nil }
+
+func (b *bitAdapter) TouchBit(ctx context.Context, bit bool) (bool, error) {
+	if !bit {
+		return false, b.WriteBit(ctx, bit)
+	}
+	return b.ReadBit(ctx)
+}
+
+func (b *bitAdapter) ReadBit(ctx context.Context) (bool, error) {
+	bit := b.reads[0]
+	b.reads = b.reads[1:]
+	return bit, nil
+}
+
+func (b *bitAdapter) WriteBit(ctx context.Context, bit bool) error {
+	b.writes = append(b.writes, bit)
+	return nil
+}
+
+type byteAdapter struct{}
+
+func (b *byteAdapter) Detect() (bool, error)          { return true, nil }
+func (b *byteAdapter) Reset() (PresenceResult, error) { return PresenceDetected, nil }
+func (b *byteAdapter) Search() ([]Address, error)     { return nil, nil }
+func (b *byteAdapter) TxRx(tx, rx []byte) error       { return nil }
+
+func TestTriplet(t *testing.T) {
+	assert := assert.New(t)
+
+	type TestVector struct {
+		Id, Cmp, Dir, Taken bool
+	}
+
+	tests := []TestVector{
+		{Id: false, Cmp: true, Dir: true, Taken: false},
+		{Id: true, Cmp: false, Dir: false, Taken: true},
+		{Id: false, Cmp: false, Dir: false, Taken: false},
+		{Id: false, Cmp: false, Dir: true, Taken: true},
+		{Id: true, Cmp: true, Dir: false, Taken: true},
+	}
+
+	for _, test := range tests {
+		a := &bitAdapter{reads: []bool{test.Id, test.Cmp}}
+		id, cmp, taken, err := Triplet(context.Background(), a, test.Dir)
+		if assert.NoError(err) {
+			assert.Equal(test.Id, id)
+			assert.Equal(test.Cmp, cmp)
+			assert.Equal(test.Taken, taken)
+			assert.Equal([]bool{test.Taken}, a.writes)
+		}
+	}
+
+	_, _, _, err := Triplet(context.Background(), &byteAdapter{}, true)
+	assert.Equal(ErrNotSupported, err)
+}
+
+// hiddenBits claims the bit operations but reports it can't do them.
+type hiddenBits struct {
+	bitAdapter
+}
+
+func (h *hiddenBits) Capabilities() Capability { return 0 }
+
+func TestCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(CapBit|CapTriplet, Capabilities(&bitAdapter{}))
+	assert.Equal(Capability(0), Capabilities(&byteAdapter{}))
+	assert.Equal(Capability(0), Capabilities(&hiddenBits{}))
+
+	_, _, _, err := Triplet(context.Background(), &hiddenBits{}, true)
+	assert.Equal(ErrNotSupported, err)
+}
+
+func TestContextHelpers(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &byteAdapter{}
+
+	ok, err := DetectContext(ctx, a)
+	assert.NoError(err)
+	assert.True(ok)
+	_, err = ResetContext(ctx, a)
+	assert.NoError(err)
+	assert.NoError(TxRxContext(ctx, a, []byte{0xcc}, nil))
+
+	cancel()
+
+	_, err = DetectContext(ctx, a)
+	assert.Equal(context.Canceled, err)
+	_, err = ResetContext(ctx, a)
+	assert.Equal(context.Canceled, err)
+	_, err = SearchContext(ctx, a)
+	assert.Equal(context.Canceled, err)
+	assert.Equal(context.Canceled, TxRxContext(ctx, a, []byte{0xcc}, nil))
+}
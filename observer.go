@@ -0,0 +1,33 @@
+package go1wire
+
+// An Observer is told about problems that adapters and device drivers handle
+// or report, so a degrading bus can be noticed before operations start to
+// fail.  The methods must be safe to call from multiple goroutines.
+type Observer interface {
+	// CRCError is called when data read from the device failed its CRC.
+	CRCError(a Address)
+
+	// Resync is called each time an adapter resynchronizes with its
+	// hardware after an invalid response.
+	Resync()
+}
+
+type nopObserver struct{}
+
+func (nopObserver) CRCError(a Address) {}
+func (nopObserver) Resync()            {}
+
+// SetObserver sets the observer device drivers report to.  It must be called
+// before the bus is used.  NewBus uses the adapter if it is an Observer.
+func (b *Bus) SetObserver(o Observer) {
+	b.observer = o
+}
+
+// Observer returns the observer of the bus.  If none is set an observer that
+// ignores everything is returned.
+func (b *Bus) Observer() Observer {
+	if nil == b.observer {
+		return nopObserver{}
+	}
+	return b.observer
+}
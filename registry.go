@@ -0,0 +1,231 @@
+package go1wire
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Device is a driver for a device on a bus.
+type Device interface {
+	// Address returns the address of the device.
+	Address() Address
+
+	String() string
+}
+
+// A Family describes the devices that share a family code.
+type Family struct {
+	Code        byte
+	Name        string // The part name(s), "DS18B20".
+	Description string
+
+	// New creates a driver for the device at the address.  New is nil if no
+	// driver has been registered for the family.
+	New func(bus *Bus, a Address) (Device, error)
+
+	// Functions describes the function commands of the family so tools
+	// such as tracers can decode them.
+	Functions map[byte]Function
+}
+
+// CRCKind is the kind of CRC that protects a function command.
+type CRCKind int
+
+const (
+	// CRCNone is used when there is no CRC.
+	CRCNone CRCKind = iota
+
+	// CRC8 is used when the bytes read after the command end with the CRC8
+	// of the bytes before it.
+	CRC8
+
+	// CRC16 is used when the command, its arguments and the data end with
+	// the inverted CRC16 of everything before it.
+	CRC16
+)
+
+// A Function describes a function command of a family.
+type Function struct {
+	Name string // "READ SCRATCHPAD"
+	CRC  CRCKind
+}
+
+// String provides the name of the family.
+func (f Family) String() string {
+	if "" == f.Name {
+		return fmt.Sprintf("Unknown (%02x)", f.Code)
+	}
+	return f.Name
+}
+
+var registry = struct {
+	sync.RWMutex
+	families map[byte]Family
+}{
+	families: map[byte]Family{
+		0x01: {Code: 0x01, Name: "DS2401", Description: "Silicon serial number"},
+		0x05: {Code: 0x05, Name: "DS2405", Description: "Addressable switch"},
+		0x09: {Code: 0x09, Name: "DS2502", Description: "1 kbit add-only memory"},
+		0x10: {Code: 0x10, Name: "DS18S20", Description: "High-precision digital thermometer"},
+		0x12: {Code: 0x12, Name: "DS2406", Description: "Dual addressable switch with 1 kbit memory"},
+		0x1d: {Code: 0x1d, Name: "DS2423", Description: "4 kbit RAM with counter"},
+		0x20: {Code: 0x20, Name: "DS2450", Description: "Quad A/D converter"},
+		0x22: {Code: 0x22, Name: "DS1822", Description: "Econo digital thermometer"},
+		0x23: {Code: 0x23, Name: "DS2433", Description: "4 kbit EEPROM"},
+		0x26: {Code: 0x26, Name: "DS2438", Description: "Smart battery monitor"},
+		0x28: {Code: 0x28, Name: "DS18B20", Description: "Programmable resolution digital thermometer"},
+		0x29: {Code: 0x29, Name: "DS2408", Description: "8-channel addressable switch"},
+		0x2d: {Code: 0x2d, Name: "DS2431", Description: "1 kbit EEPROM"},
+		0x3a: {Code: 0x3a, Name: "DS2413", Description: "Dual channel addressable switch"},
+		0x3b: {Code: 0x3b, Name: "DS1825", Description: "Programmable resolution digital thermometer with ID"},
+		0x42: {Code: 0x42, Name: "DS28EA00", Description: "Digital thermometer with sequence detect"},
+		0x81: {Code: 0x81, Name: "DS1420", Description: "Serial ID button"},
+	},
+}
+
+// RegisterFamily makes a family known, usually along with the driver for it.
+// Device packages call it from their init function so importing the package
+// is enough for its devices to be found.  An empty Name, Description or
+// Functions keeps the one already known for the code.  RegisterFamily panics
+// if a driver is already registered for the family.
+func RegisterFamily(f Family) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	old, ok := registry.families[f.Code]
+	if ok {
+		if nil != old.New && nil != f.New {
+			panic(fmt.Sprintf("onewire: driver already registered for family %02x", f.Code))
+		}
+		if "" == f.Name {
+			f.Name = old.Name
+		}
+		if "" == f.Description {
+			f.Description = old.Description
+		}
+		if nil == f.New {
+			f.New = old.New
+		}
+		if nil == f.Functions {
+			f.Functions = old.Functions
+		}
+	}
+
+	registry.families[f.Code] = f
+}
+
+// LookupFamily returns the family for the code.  If the family is not known
+// the Family only has the Code set and false is returned.
+func LookupFamily(code byte) (Family, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.families[code]
+	if !ok {
+		f.Code = code
+	}
+	return f, ok
+}
+
+// Families returns all the known families ordered by code.
+func Families() []Family {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	list := make([]Family, 0, len(registry.families))
+	for _, f := range registry.families {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+
+	return list
+}
+
+// FamilyInfo returns the family of the address.
+func (a Address) FamilyInfo() Family {
+	f, _ := LookupFamily(a.Family())
+	return f
+}
+
+// A Thermometer is a Device that measures temperature.
+type Thermometer interface {
+	Device
+
+	// Convert starts a temperature conversion and waits for it to complete.
+	Convert(ctx context.Context) error
+
+	// LastTempContext returns the last measured temperature in degrees C.
+	LastTempContext(ctx context.Context) (float64, error)
+}
+
+// A Generic device is used for devices without a registered driver.
+type Generic struct {
+	address Address
+}
+
+// NewGeneric creates a Generic device for the address.
+func NewGeneric(a Address) *Generic {
+	return &Generic{address: a}
+}
+
+// Address returns the address of the device.
+func (g *Generic) Address() Address {
+	return g.address
+}
+
+func (g *Generic) String() string {
+	return g.address.String() + " - " + g.address.FamilyInfo().String()
+}
+
+// NewDevice creates the driver registered for the family of the address.  If
+// there is no driver ErrNoDriver is returned.
+func NewDevice(bus *Bus, a Address) (Device, error) {
+	f, _ := LookupFamily(a.Family())
+	if nil == f.New {
+		return nil, ErrNoDriver
+	}
+	return f.New(bus, a)
+}
+
+// Devices searches the bus and returns a driver for every device found.  A
+// Generic device is returned for devices without a registered driver.
+func (b *Bus) Devices(ctx context.Context) ([]Device, error) {
+	list, err := b.Search(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	devices := make([]Device, 0, len(list))
+	for _, a := range list {
+		d, err := NewDevice(b, a)
+		if ErrNoDriver == err {
+			d, err = NewGeneric(a), nil
+		}
+		if nil != err {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, nil
+}
+
+// Thermometers searches the bus and returns every device that is a
+// Thermometer.
+func (b *Bus) Thermometers(ctx context.Context) ([]Thermometer, error) {
+	devices, err := b.Devices(ctx)
+	if nil != err {
+		return nil, err
+	}
+
+	var list []Thermometer
+	for _, d := range devices {
+		if t, ok := d.(Thermometer); ok {
+			list = append(list, t)
+		}
+	}
+
+	return list, nil
+}
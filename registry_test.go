@@ -0,0 +1,152 @@
+package go1wire
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDevice struct {
+	address Address
+}
+
+func (d *testDevice) Address() Address { return d.address }
+func (d *testDevice) String() string   { return d.address.String() + " - test" }
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	// Built in names without a driver
+	f, ok := LookupFamily(0x28)
+	assert.True(ok)
+	assert.Equal("DS18B20", f.String())
+	assert.Nil(f.New)
+
+	f, ok = LookupFamily(0xf7)
+	assert.False(ok)
+	assert.Equal(byte(0xf7), f.Code)
+	assert.Equal("Unknown (f7)", f.String())
+
+	a, _ := ParseAddress("f7.000000000001.--")
+	_, err := NewDevice(NewBus(&logAdapter{}), a)
+	assert.Equal(ErrNoDriver, err)
+
+	RegisterFamily(Family{
+		Code:        0xf7,
+		Name:        "TEST",
+		Description: "Test device",
+		New: func(bus *Bus, a Address) (Device, error) {
+			return &testDevice{address: a}, nil
+		},
+		Functions: map[byte]Function{0xbe: {Name: "READ", CRC: CRC8}},
+	})
+	defer func() {
+		registry.Lock()
+		delete(registry.families, 0xf7)
+		registry.Unlock()
+	}()
+
+	assert.Equal("TEST", a.FamilyInfo().Name)
+	d, err := NewDevice(NewBus(&logAdapter{}), a)
+	if assert.NoError(err) {
+		assert.Equal(a, d.Address())
+	}
+
+	// Adding details keeps the driver
+	RegisterFamily(Family{Code: 0xf7, Description: "Better description"})
+	f, _ = LookupFamily(0xf7)
+	assert.Equal("TEST", f.Name)
+	assert.Equal("Better description", f.Description)
+	assert.NotNil(f.New)
+	assert.Equal(Function{Name: "READ", CRC: CRC8}, f.Functions[0xbe])
+
+	assert.Panics(func() {
+		RegisterFamily(Family{
+			Code: 0xf7,
+			New:  func(bus *Bus, a Address) (Device, error) { return nil, nil },
+		})
+	})
+
+	list := Families()
+	for i := 1; i < len(list); i++ {
+		assert.True(list[i-1].Code < list[i].Code)
+	}
+}
+
+type testThermometer struct {
+	testDevice
+}
+
+func (d *testThermometer) Convert(ctx context.Context) error { return nil }
+func (d *testThermometer) LastTempContext(ctx context.Context) (float64, error) {
+	return 21.5, nil
+}
+
+func TestBusDevices(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"f6.000000000001.--",
+		"f6.000000000002.--",
+		"f5.000000000001.--",
+		"f4.000000000001.--",
+	)
+
+	RegisterFamily(Family{
+		Code: 0xf6,
+		Name: "THERM",
+		New: func(bus *Bus, a Address) (Device, error) {
+			return &testThermometer{testDevice{address: a}}, nil
+		},
+	})
+	RegisterFamily(Family{
+		Code: 0xf5,
+		Name: "OTHER",
+		New: func(bus *Bus, a Address) (Device, error) {
+			return &testDevice{address: a}, nil
+		},
+	})
+	defer func() {
+		registry.Lock()
+		delete(registry.families, 0xf6)
+		delete(registry.families, 0xf5)
+		registry.Unlock()
+	}()
+
+	bus := NewBus(&tripletBus{roms: roms})
+
+	devices, err := bus.Devices(ctx)
+	if assert.NoError(err) && assert.Len(devices, 4) {
+		found := map[Address]Device{}
+		for _, d := range devices {
+			found[d.Address()] = d
+		}
+		assert.IsType(&testThermometer{}, found[roms[0]])
+		assert.IsType(&testThermometer{}, found[roms[1]])
+		assert.IsType(&testDevice{}, found[roms[2]])
+		if assert.IsType(&Generic{}, found[roms[3]]) {
+			assert.Equal(roms[3].String()+" - Unknown (f4)", found[roms[3]].String())
+		}
+	}
+
+	therms, err := bus.Thermometers(ctx)
+	if assert.NoError(err) && assert.Len(therms, 2) {
+		temp, err := therms[0].LastTempContext(ctx)
+		assert.NoError(err)
+		assert.Equal(21.5, temp)
+	}
+
+	// Failed drivers are reported
+	failed := errors.New("failed")
+	registry.Lock()
+	registry.families[0xf5] = Family{
+		Code: 0xf5,
+		New:  func(bus *Bus, a Address) (Device, error) { return nil, failed },
+	}
+	registry.Unlock()
+	_, err = bus.Devices(ctx)
+	assert.Equal(failed, err)
+}
@@ -0,0 +1,171 @@
+// Package retry provides Bus middleware that retries whole transactions that
+// failed with a transient error, such as a CRC mismatch caused by noise on a
+// long cable.  The transaction is repeated from the reset so the device is
+// selected again; retrying a single adapter operation could not do that.
+//
+//	r := retry.New(retry.Policy{Attempts: 5})
+//	bus.Use(r.Middleware)
+//
+// Transactions marked with Tx.MarkNonIdempotent, such as copying to EEPROM,
+// are never retried unless the context allows it with AllowNonIdempotent.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+)
+
+// The defaults used for the zero values of a Policy.
+const (
+	DefaultAttempts   = 3
+	DefaultBackoff    = time.Millisecond * 10
+	DefaultMaxBackoff = time.Second
+)
+
+// A Policy describes when and how often a transaction is retried.
+type Policy struct {
+	// Attempts is the total number of times the transaction is tried.
+	Attempts int
+
+	// Backoff is the wait before the first retry.  It doubles with each
+	// following retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction (0 to 1) of each wait that is randomized so
+	// buses sharing a fault don't retry in step.
+	Jitter float64
+
+	// Retryable decides if the error is transient.  If nil Transient is
+	// used.
+	Retryable func(err error) bool
+
+	// OnRetry is called before each retry with the number of the attempt
+	// that failed and its error.
+	OnRetry func(attempt int, err error)
+}
+
+// Transient returns true for the errors that noise on the bus causes: CRC
+// mismatches and invalid responses from the adapter.
+func Transient(err error) bool {
+	return errors.Is(err, go1wire.ErrCRC) || errors.Is(err, go1wire.ErrInvalidResponse)
+}
+
+type allowKey struct{}
+
+// AllowNonIdempotent returns a context that allows transactions marked as
+// non-idempotent to be retried.
+func AllowNonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowKey{}, true)
+}
+
+// A Retrier retries transactions following its Policy and counts the
+// retries.  It is safe to use with multiple buses.
+type Retrier struct {
+	policy Policy
+
+	retries   uint64
+	exhausted uint64
+}
+
+// New creates a Retrier for the policy.
+func New(p Policy) *Retrier {
+	if p.Attempts < 1 {
+		p.Attempts = DefaultAttempts
+	}
+	if 0 == p.Backoff {
+		p.Backoff = DefaultBackoff
+	}
+	if 0 == p.MaxBackoff {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if 1 < p.Jitter {
+		p.Jitter = 1
+	}
+	if nil == p.Retryable {
+		p.Retryable = Transient
+	}
+	return &Retrier{policy: p}
+}
+
+// Retries returns the number of retries performed.
+func (r *Retrier) Retries() uint64 {
+	return atomic.LoadUint64(&r.retries)
+}
+
+// Exhausted returns the number of transactions that still failed with a
+// transient error after all the attempts.
+func (r *Retrier) Exhausted() uint64 {
+	return atomic.LoadUint64(&r.exhausted)
+}
+
+// Middleware is the go1wire.Middleware that retries the transactions.  The
+// bus stays locked while waiting between attempts.
+func (r *Retrier) Middleware(next go1wire.TxFunc) go1wire.TxFunc {
+	return func(tx *go1wire.Tx) error {
+		ctx := tx.Context()
+		allowed, _ := ctx.Value(allowKey{}).(bool)
+
+		for attempt := 1; ; attempt++ {
+			err := next(tx)
+			if nil == err || !r.policy.Retryable(err) {
+				return err
+			}
+			if !tx.Idempotent() && !allowed {
+				return err
+			}
+			if r.policy.Attempts <= attempt {
+				atomic.AddUint64(&r.exhausted, 1)
+				return err
+			}
+
+			atomic.AddUint64(&r.retries, 1)
+			if nil != r.policy.OnRetry {
+				r.policy.OnRetry(attempt, err)
+			}
+
+			if err := sleep(ctx, r.backoff(attempt)); nil != err {
+				return err
+			}
+		}
+	}
+}
+
+// backoff provides the wait after the failed attempt.
+func (r *Retrier) backoff(attempt int) time.Duration {
+	d := r.policy.Backoff
+	for i := 1; i < attempt && d < r.policy.MaxBackoff; i++ {
+		d *= 2
+	}
+	if r.policy.MaxBackoff < d {
+		d = r.policy.MaxBackoff
+	}
+
+	if 0 < r.policy.Jitter {
+		j := time.Duration(float64(d) * r.policy.Jitter * (2*rand.Float64() - 1))
+		d += j
+	}
+
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+	return nil
+}
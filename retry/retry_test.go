@@ -0,0 +1,144 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/schmidtw/go1wire"
+	"github.com/schmidtw/go1wire/adapters/sim"
+	"github.com/schmidtw/go1wire/devices/ds18x20"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyBus fails the first exchanges of data with the error.
+type flakyBus struct {
+	*sim.Bus
+	fail int
+	err  error
+}
+
+func (f *flakyBus) TxRxContext(ctx context.Context, tx, rx []byte) error {
+	if err := f.Bus.TxRxContext(ctx, tx, rx); nil != err {
+		return err
+	}
+	if 0 < f.fail && 0xff == tx[len(tx)-1] {
+		f.fail--
+		if nil != f.err {
+			return f.err
+		}
+		// Corrupt the CRC
+		rx[len(rx)-1] ^= 0x01
+	}
+	return nil
+}
+
+func setup(t *testing.T, p Policy) (*flakyBus, *go1wire.Bus, *ds18x20.Ds18x20, *Retrier) {
+	a, err := go1wire.ParseAddress("28.000000000001.--")
+	if nil != err {
+		t.Fatal(err)
+	}
+	f := &flakyBus{Bus: sim.NewBus(sim.NewDS18B20(a).Device)}
+	bus := go1wire.NewBus(f)
+	r := New(p)
+	bus.Use(r.Middleware)
+
+	d, err := ds18x20.New(bus, a)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return f, bus, d, r
+}
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var seen []int
+	f, _, d, r := setup(t, Policy{
+		Attempts: 3,
+		Backoff:  time.Microsecond,
+		OnRetry:  func(attempt int, err error) { seen = append(seen, attempt) },
+	})
+
+	// Two CRC errors are hidden
+	f.fail = 2
+	temp, err := d.LastTempContext(ctx)
+	assert.NoError(err)
+	assert.Equal(85.0, temp)
+	assert.Equal(uint64(2), r.Retries())
+	assert.Equal([]int{1, 2}, seen)
+
+	// Three are not
+	f.fail = 3
+	_, err = d.LastTempContext(ctx)
+	assert.True(errors.Is(err, go1wire.ErrCRC))
+	assert.Equal(uint64(4), r.Retries())
+	assert.Equal(uint64(1), r.Exhausted())
+
+	// Errors that are not transient are returned right away
+	f.fail = 1
+	f.err = errors.New("broken")
+	_, err = d.LastTempContext(ctx)
+	assert.Equal(f.err, err)
+	assert.Equal(uint64(4), r.Retries())
+}
+
+func TestNonIdempotent(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	f, bus, d, r := setup(t, Policy{Backoff: time.Microsecond})
+	f.err = go1wire.ErrInvalidResponse
+
+	// Learn the power supply first so it is not part of the copy
+	f.fail = 1
+	_, err := d.Parasite(ctx)
+	assert.NoError(err)
+	assert.Equal(uint64(1), r.Retries())
+
+	write := func(tx *go1wire.Tx) error {
+		tx.MarkNonIdempotent()
+		if err := tx.SkipROM(); nil != err {
+			return err
+		}
+		return tx.Write([]byte{0x48, 0xff})
+	}
+
+	f.fail = 1
+	assert.Equal(go1wire.ErrInvalidResponse, bus.Do(ctx, write))
+	assert.Equal(uint64(1), r.Retries())
+
+	f.fail = 1
+	assert.NoError(bus.Do(AllowNonIdempotent(ctx), write))
+	assert.Equal(uint64(2), r.Retries())
+}
+
+func TestCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	f, _, d, r := setup(t, Policy{Attempts: 5, Backoff: time.Hour})
+	f.fail = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := d.LastTempContext(ctx)
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal(uint64(1), r.Retries())
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	r := New(Policy{})
+	assert.Equal(DefaultBackoff, r.backoff(1))
+	assert.Equal(DefaultBackoff*4, r.backoff(3))
+	assert.Equal(DefaultMaxBackoff, r.backoff(20))
+
+	r = New(Policy{Backoff: time.Second, MaxBackoff: time.Minute, Jitter: 2})
+	for i := 0; i < 100; i++ {
+		d := r.backoff(1)
+		assert.True(0 <= d && d <= 2*time.Second)
+	}
+}
@@ -0,0 +1,356 @@
+package go1wire
+
+import (
+	"context"
+	"encoding/binary"
+)
+
+const (
+	ROM_SEARCH       = 0xf0
+	ROM_ALARM_SEARCH = 0xec
+)
+
+// An AlarmSearcher is an Adapter that provides the conditional search itself.
+type AlarmSearcher interface {
+	Adapter
+
+	// AlarmSearchContext returns the addresses of the devices with their
+	// alarm flag set.
+	AlarmSearchContext(ctx context.Context) ([]Address, error)
+}
+
+// A SearchAccelerator is an Adapter that is able to perform a complete pass
+// through the search tree itself.
+type SearchAccelerator interface {
+	Adapter
+
+	// SearchPass issues the search command cmd on a bus that has already
+	// been reset and walks the tree.  When a discrepancy is found at bit i
+	// the direction taken is bit i of path.  The ROM found is returned in
+	// search order (bit 0 is the first bit seen on the bus) along with the
+	// bit positions of the discrepancies where the 0 branch was taken.
+	SearchPass(ctx context.Context, cmd byte, path uint64) (rom uint64, forks []int, err error)
+}
+
+// A FamilySearcher is an Adapter that provides searching for and skipping
+// device families itself.
+type FamilySearcher interface {
+	Adapter
+
+	// SearchFamilyContext returns the addresses of the devices of the
+	// family.
+	SearchFamilyContext(ctx context.Context, family byte) ([]Address, error)
+
+	// SearchExceptContext returns the addresses of the devices that are not
+	// part of the listed families.
+	SearchExceptContext(ctx context.Context, families ...byte) ([]Address, error)
+}
+
+// A Search walks the devices on a bus using the algorithm described in
+// Maxim / Dallas Semi AN187.  The state is kept between calls so a search
+// may be stopped and resumed at any point.
+//
+// The discrepancy values are the 1 based bit numbers used in AN187 with 0
+// meaning there is none.
+type Search struct {
+	LastDiscrepancy       int
+	LastFamilyDiscrepancy int
+	LastDevice            bool
+
+	adapter Adapter
+	cmd     byte
+	rom     uint64
+}
+
+// NewSearch creates a Search over the adapter.  The adapter must either be
+// a SearchAccelerator or provide the triplet or bit level operations.
+func NewSearch(a Adapter) *Search {
+	return &Search{adapter: a, cmd: ROM_SEARCH}
+}
+
+// NewAlarmSearch creates a Search over the adapter that only finds the
+// devices with their alarm flag set.
+func NewAlarmSearch(a Adapter) *Search {
+	return &Search{adapter: a, cmd: ROM_ALARM_SEARCH}
+}
+
+// AlarmSearch returns the addresses of all the devices on the bus with their
+// alarm flag set.
+func AlarmSearch(ctx context.Context, a Adapter) ([]Address, error) {
+	if s, ok := a.(AlarmSearcher); ok {
+		return s.AlarmSearchContext(ctx)
+	}
+	return NewAlarmSearch(a).All(ctx)
+}
+
+// SearchFamily returns the addresses of all the devices on the bus of the
+// family.
+func SearchFamily(ctx context.Context, a Adapter, family byte) ([]Address, error) {
+	if s, ok := a.(FamilySearcher); ok {
+		return s.SearchFamilyContext(ctx, family)
+	}
+	return NewSearch(a).Family(ctx, family)
+}
+
+// SearchExcept returns the addresses of all the devices on the bus that are
+// not part of the listed families.
+func SearchExcept(ctx context.Context, a Adapter, families ...byte) ([]Address, error) {
+	if s, ok := a.(FamilySearcher); ok {
+		return s.SearchExceptContext(ctx, families...)
+	}
+	return NewSearch(a).Except(ctx, families...)
+}
+
+// First resets the search state and finds the first device on the bus.  If
+// no device was found false is returned.
+func (s *Search) First(ctx context.Context) (Address, bool, error) {
+	s.LastDiscrepancy = 0
+	s.LastFamilyDiscrepancy = 0
+	s.LastDevice = false
+
+	return s.Next(ctx)
+}
+
+// Next finds the next device on the bus.  If there are no more devices
+// false is returned.
+func (s *Search) Next(ctx context.Context) (Address, bool, error) {
+	rom, ok, err := s.step(ctx)
+	if nil != err || !ok {
+		return 0, false, err
+	}
+
+	a, err := AddressFromSearch(rom)
+	if nil != err {
+		return 0, false, err
+	}
+
+	return a, true, nil
+}
+
+// Verify checks that the device with the address is present on the bus.
+// The search state is left unchanged.
+func (s *Search) Verify(ctx context.Context, a Address) (bool, error) {
+	saved := *s
+
+	s.rom = binary.LittleEndian.Uint64(a.Bytes())
+	s.LastDiscrepancy = 64
+	s.LastFamilyDiscrepancy = 0
+	s.LastDevice = false
+
+	rom, ok, err := s.step(ctx)
+
+	*s = saved
+
+	if nil != err || !ok {
+		return false, err
+	}
+
+	return rom == binary.LittleEndian.Uint64(a.Bytes()), nil
+}
+
+// All restarts the search and returns all the devices found.  Devices that
+// do not return a valid address are skipped.
+func (s *Search) All(ctx context.Context) ([]Address, error) {
+	list := []Address{}
+
+	s.LastDiscrepancy = 0
+	s.LastFamilyDiscrepancy = 0
+	s.LastDevice = false
+
+	for {
+		rom, ok, err := s.step(ctx)
+		if nil != err {
+			return nil, err
+		}
+		if !ok {
+			return list, nil
+		}
+
+		if a, err := AddressFromSearch(rom); nil == err {
+			list = append(list, a)
+		}
+	}
+}
+
+// Target sets up the search so the next call to Next finds the first device
+// of the family, if there is one.  If no device of the family is present the
+// next device found will be of a different family.
+func (s *Search) Target(family byte) {
+	s.rom = uint64(family)
+	s.LastDiscrepancy = 64
+	s.LastFamilyDiscrepancy = 0
+	s.LastDevice = false
+}
+
+// SkipFamily sets up the search so the next call to Next skips over the rest
+// of the devices with the same family as the last device found.
+func (s *Search) SkipFamily() {
+	s.LastDiscrepancy = s.LastFamilyDiscrepancy
+	s.LastFamilyDiscrepancy = 0
+
+	if 0 == s.LastDiscrepancy {
+		s.LastDevice = true
+	}
+}
+
+// Family restarts the search and returns all the devices of the family
+// found.  Devices that do not return a valid address are skipped.
+func (s *Search) Family(ctx context.Context, family byte) ([]Address, error) {
+	list := []Address{}
+
+	s.Target(family)
+
+	for {
+		rom, ok, err := s.step(ctx)
+		if nil != err {
+			return nil, err
+		}
+		if !ok {
+			return list, nil
+		}
+
+		a, err := AddressFromSearch(rom)
+		if nil != err {
+			continue
+		}
+
+		// Devices are found in order, so any other family means there are
+		// no more devices in this one.
+		if family != a.Family() {
+			return list, nil
+		}
+		list = append(list, a)
+	}
+}
+
+// Except restarts the search and returns all the devices found that are not
+// part of the listed families.  The devices of the listed families are
+// skipped over without being walked.  Devices that do not return a valid
+// address are skipped.
+func (s *Search) Except(ctx context.Context, families ...byte) ([]Address, error) {
+	list := []Address{}
+
+	skip := make(map[byte]bool, len(families))
+	for _, family := range families {
+		skip[family] = true
+	}
+
+	s.LastDiscrepancy = 0
+	s.LastFamilyDiscrepancy = 0
+	s.LastDevice = false
+
+	for {
+		rom, ok, err := s.step(ctx)
+		if nil != err {
+			return nil, err
+		}
+		if !ok {
+			return list, nil
+		}
+
+		a, err := AddressFromSearch(rom)
+		if nil != err {
+			continue
+		}
+
+		if skip[a.Family()] {
+			s.SkipFamily()
+			continue
+		}
+		list = append(list, a)
+	}
+}
+
+// path provides the direction to take at each discrepancy for the next pass.
+func (s *Search) path() uint64 {
+	if 0 == s.LastDiscrepancy {
+		return 0
+	}
+
+	n := uint(s.LastDiscrepancy - 1)
+	return (s.rom & (uint64(1)<<n - 1)) | (1 << n)
+}
+
+// step performs a single pass of the search and updates the state.
+func (s *Search) step(ctx context.Context) (uint64, bool, error) {
+	if s.LastDevice {
+		return 0, false, nil
+	}
+
+	presence, err := ResetContext(ctx, s.adapter)
+	if nil != err {
+		return 0, false, err
+	}
+	if PresenceShorted == presence {
+		return 0, false, ErrBusShorted
+	}
+
+	ok := false
+	var rom uint64
+	var forks []int
+	if PresenceNone != presence {
+		rom, forks, ok, err = s.pass(ctx, s.path())
+		if nil != err {
+			return 0, false, err
+		}
+	}
+	if !ok {
+		s.LastDiscrepancy = 0
+		s.LastFamilyDiscrepancy = 0
+		s.LastDevice = false
+		return 0, false, nil
+	}
+
+	// Every discrepancy along the path is reported each pass, so the state
+	// can be rebuilt from scratch.
+	last, family := 0, 0
+	for _, fork := range forks {
+		if last < fork+1 {
+			last = fork + 1
+		}
+		if fork < 8 && family < fork+1 {
+			family = fork + 1
+		}
+	}
+
+	s.rom = rom
+	s.LastDiscrepancy = last
+	s.LastFamilyDiscrepancy = family
+	s.LastDevice = 0 == last
+
+	return rom, true, nil
+}
+
+// pass walks the tree once following the path.  If no devices responded
+// false is returned.
+func (s *Search) pass(ctx context.Context, path uint64) (uint64, []int, bool, error) {
+	if 0 != Capabilities(s.adapter)&CapSearchPass {
+		rom, forks, err := s.adapter.(SearchAccelerator).SearchPass(ctx, s.cmd, path)
+		// Every bit reads as a 1 when nobody is on the bus.
+		return rom, forks, ^uint64(0) != rom, err
+	}
+
+	if err := TxRxContext(ctx, s.adapter, []byte{s.cmd}, make([]byte, 1)); nil != err {
+		return 0, nil, false, err
+	}
+
+	var rom uint64
+	var forks []int
+	for i := uint(0); i < 64; i++ {
+		id, cmp, taken, err := Triplet(ctx, s.adapter, 0 != 1&(path>>i))
+		if nil != err {
+			return 0, nil, false, err
+		}
+		if id && cmp {
+			return 0, nil, false, nil
+		}
+		if !id && !cmp && !taken {
+			forks = append(forks, int(i))
+		}
+		if taken {
+			rom |= 1 << i
+		}
+	}
+
+	return rom, forks, true, nil
+}
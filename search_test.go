@@ -0,0 +1,262 @@
+package go1wire
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tripletBus is a simple model of devices responding to the search triplet.
+type tripletBus struct {
+	roms   []Address
+	alarms map[Address]bool
+	active []uint64
+	bit    uint
+	resets int
+}
+
+func (b *tripletBus) Detect() (bool, error) { return true, nil }
+func (b *tripletBus) Search() ([]Address, error) {
+	return NewSearch(b).All(context.Background())
+}
+
+func (b *tripletBus) TxRx(tx, rx []byte) error {
+	if ROM_ALARM_SEARCH == tx[0] {
+		b.active = nil
+		for _, a := range b.roms {
+			if b.alarms[a] {
+				b.active = append(b.active, binary.LittleEndian.Uint64(a.Bytes()))
+			}
+		}
+	}
+	return nil
+}
+
+func (b *tripletBus) Reset() (PresenceResult, error) {
+	b.resets++
+	b.bit = 0
+	b.active = nil
+	for _, a := range b.roms {
+		b.active = append(b.active, binary.LittleEndian.Uint64(a.Bytes()))
+	}
+	if 0 == len(b.roms) {
+		return PresenceNone, nil
+	}
+	return PresenceDetected, nil
+}
+
+func (b *tripletBus) Triplet(ctx context.Context, dir bool) (id, cmp, taken bool, err error) {
+	id, cmp = true, true
+	for _, rom := range b.active {
+		if 0 == 1&(rom>>b.bit) {
+			id = false
+		} else {
+			cmp = false
+		}
+	}
+
+	switch {
+	case id && cmp:
+		taken = true
+	case id != cmp:
+		taken = id
+	default:
+		taken = dir
+	}
+
+	var still []uint64
+	for _, rom := range b.active {
+		if taken == (0 != 1&(rom>>b.bit)) {
+			still = append(still, rom)
+		}
+	}
+	b.active = still
+	b.bit++
+
+	return id, cmp, taken, nil
+}
+
+func mustParse(t *testing.T, list ...string) []Address {
+	var rv []Address
+	for _, s := range list {
+		a, err := ParseAddress(s)
+		if nil != err {
+			t.Fatal(err)
+		}
+		rv = append(rv, a)
+	}
+	return rv
+}
+
+func TestSearchAll(t *testing.T) {
+	assert := assert.New(t)
+
+	roms := mustParse(t,
+		"10.450736030800.--",
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"28.800000000002.--",
+		"01.4507360308ff.--",
+	)
+
+	bus := &tripletBus{roms: roms}
+	got, err := bus.Search()
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms, got)
+		assert.Equal(len(roms), bus.resets)
+	}
+
+	// Nothing on the bus
+	bus = &tripletBus{}
+	got, err = bus.Search()
+	assert.NoError(err)
+	assert.Empty(got)
+}
+
+func TestSearchFirstNext(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"10.450736030800.--",
+	)
+
+	s := NewSearch(&tripletBus{roms: roms})
+
+	seen := []Address{}
+	a, ok, err := s.First(ctx)
+	for ; ok && nil == err; a, ok, err = s.Next(ctx) {
+		seen = append(seen, a)
+		assert.Equal(len(seen) == len(roms), s.LastDevice)
+	}
+	assert.NoError(err)
+	assert.ElementsMatch(roms, seen)
+
+	// Stop early and resume
+	a, ok, err = s.First(ctx)
+	assert.True(ok)
+	assert.NoError(err)
+	assert.Equal(seen[0], a)
+	a, ok, err = s.Next(ctx)
+	assert.True(ok)
+	assert.NoError(err)
+	assert.Equal(seen[1], a)
+}
+
+func TestSearchVerify(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"28.000000000002.--",
+	)
+	missing := mustParse(t, "28.000000000003.--")[0]
+
+	s := NewSearch(&tripletBus{roms: roms})
+	_, _, err := s.First(ctx)
+	assert.NoError(err)
+	state := *s
+
+	ok, err := s.Verify(ctx, roms[1])
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = s.Verify(ctx, missing)
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.Equal(state, *s)
+}
+
+func TestAlarmSearch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"28.000000000003.--",
+		"10.450736030800.--",
+	)
+
+	bus := &tripletBus{
+		roms: roms,
+		alarms: map[Address]bool{
+			roms[1]: true,
+			roms[3]: true,
+		},
+	}
+
+	got, err := AlarmSearch(ctx, bus)
+	if assert.NoError(err) {
+		assert.ElementsMatch([]Address{roms[1], roms[3]}, got)
+	}
+
+	// No alarms
+	bus.alarms = nil
+	got, err = AlarmSearch(ctx, bus)
+	assert.NoError(err)
+	assert.Empty(got)
+}
+
+func TestSearchFamily(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"10.450736030800.--",
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"28.800000000002.--",
+		"29.000000000001.--",
+		"01.4507360308ff.--",
+	)
+	bus := &tripletBus{roms: roms}
+
+	got, err := SearchFamily(ctx, bus, 0x28)
+	if assert.NoError(err) {
+		assert.ElementsMatch(roms[1:4], got)
+	}
+
+	got, err = SearchFamily(ctx, bus, 0x29)
+	if assert.NoError(err) {
+		assert.Equal(roms[4:5], got)
+	}
+
+	// Not present
+	got, err = SearchFamily(ctx, bus, 0x12)
+	assert.NoError(err)
+	assert.Empty(got)
+}
+
+func TestSearchExcept(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"10.450736030800.--",
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"28.800000000002.--",
+		"29.000000000001.--",
+		"01.4507360308ff.--",
+	)
+	bus := &tripletBus{roms: roms}
+
+	got, err := SearchExcept(ctx, bus, 0x28)
+	if assert.NoError(err) {
+		assert.ElementsMatch([]Address{roms[0], roms[4], roms[5]}, got)
+	}
+	// Only the first 0x28 device is walked along with the 3 others
+	assert.Equal(4, bus.resets)
+
+	bus.resets = 0
+	got, err = SearchExcept(ctx, bus, 0x28, 0x10, 0x29, 0x01)
+	assert.NoError(err)
+	assert.Empty(got)
+}
@@ -0,0 +1,182 @@
+package go1wire
+
+import (
+	"context"
+	"time"
+)
+
+// EventType is the kind of change a Watcher saw.
+type EventType int
+
+const (
+	// Arrived is sent when a device appears on a bus.
+	Arrived EventType = iota
+
+	// Departed is sent when a device is no longer found on a bus.
+	Departed
+
+	// SearchFailed is sent when searching a bus fails.  The devices on the
+	// bus are left as they were.
+	SearchFailed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Arrived:
+		return "arrived"
+	case Departed:
+		return "departed"
+	case SearchFailed:
+		return "search failed"
+	}
+	return "unknown"
+}
+
+// An Event is a change seen by a Watcher.
+type Event struct {
+	Type    EventType
+	Address Address // Not set for SearchFailed.
+	Adapter Adapter // The adapter of the bus the change was seen on.
+	Time    time.Time
+	Err     error // Only set for SearchFailed.
+}
+
+// A Watcher periodically searches buses and sends an Event when a device
+// arrives or departs.
+type Watcher struct {
+	// Interval is the time between searches.  The default is 1 second.
+	Interval time.Duration
+
+	// Debounce is the number of searches in a row a device must be found in
+	// (or missing from) before it is reported as arrived (or departed).  The
+	// default is 1.
+	Debounce int
+
+	buses  []*Bus
+	seen   []map[Address]*presence
+	events chan Event
+	now    func() time.Time
+}
+
+// presence tracks the reported state of a device and how many searches in a
+// row disagreed with it.
+type presence struct {
+	present bool
+	count   int
+}
+
+// NewWatcher creates a Watcher for the buses.
+func NewWatcher(buses ...*Bus) *Watcher {
+	w := &Watcher{
+		Interval: time.Second,
+		Debounce: 1,
+		buses:    buses,
+		seen:     make([]map[Address]*presence, len(buses)),
+		events:   make(chan Event, 16),
+		now:      time.Now,
+	}
+	for i := range w.seen {
+		w.seen[i] = map[Address]*presence{}
+	}
+	return w
+}
+
+// Events returns the channel the events are sent on.  It is closed when Run
+// returns.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Run searches the buses every Interval until the context is done.  Run must
+// only be called once.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := w.poll(ctx); nil != err {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// poll searches each bus once and sends the resulting events.
+func (w *Watcher) poll(ctx context.Context) error {
+	debounce := w.Debounce
+	if debounce < 1 {
+		debounce = 1
+	}
+
+	for i, bus := range w.buses {
+		list, err := bus.Search(ctx)
+		if nil != ctx.Err() {
+			return ctx.Err()
+		}
+		if nil != err {
+			e := Event{Type: SearchFailed, Adapter: bus.Adapter(), Time: w.now(), Err: err}
+			if err := w.send(ctx, e); nil != err {
+				return err
+			}
+			continue
+		}
+
+		seen := w.seen[i]
+		found := make(map[Address]bool, len(list))
+		for _, a := range list {
+			found[a] = true
+			if _, ok := seen[a]; !ok {
+				seen[a] = &presence{}
+			}
+		}
+
+		for a, p := range seen {
+			if found[a] == p.present {
+				p.count = 0
+			} else {
+				p.count++
+			}
+
+			if p.count < debounce {
+				if !p.present && 0 == p.count {
+					delete(seen, a)
+				}
+				continue
+			}
+
+			p.present = !p.present
+			p.count = 0
+			e := Event{Type: Departed, Address: a, Adapter: bus.Adapter(), Time: w.now()}
+			if p.present {
+				e.Type = Arrived
+			} else {
+				delete(seen, a)
+			}
+			if err := w.send(ctx, e); nil != err {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *Watcher) send(ctx context.Context, e Event) error {
+	select {
+	case w.events <- e:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
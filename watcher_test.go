@@ -0,0 +1,124 @@
+package go1wire
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type shortedBus struct {
+	tripletBus
+}
+
+func (b *shortedBus) Search() ([]Address, error) {
+	return NewSearch(b).All(context.Background())
+}
+
+func (b *shortedBus) Reset() (PresenceResult, error) {
+	return PresenceShorted, nil
+}
+
+// drain returns the events waiting on the watcher keyed by address.
+func drain(w *Watcher) map[Address]EventType {
+	rv := map[Address]EventType{}
+	for {
+		select {
+		case e := <-w.events:
+			rv[e.Address] = e.Type
+		default:
+			return rv
+		}
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	roms := mustParse(t,
+		"28.000000000001.--",
+		"28.000000000002.--",
+		"10.450736030800.--",
+	)
+
+	a := &tripletBus{roms: roms[:2]}
+	w := NewWatcher(NewBus(a))
+	w.Debounce = 2
+
+	// Arrivals need to be seen twice
+	assert.NoError(w.poll(ctx))
+	assert.Empty(drain(w))
+	assert.NoError(w.poll(ctx))
+	assert.Equal(map[Address]EventType{roms[0]: Arrived, roms[1]: Arrived}, drain(w))
+	assert.NoError(w.poll(ctx))
+	assert.Empty(drain(w))
+
+	// A device missing from a single search is not reported
+	a.roms = roms[1:2]
+	assert.NoError(w.poll(ctx))
+	a.roms = roms[:2]
+	assert.NoError(w.poll(ctx))
+	assert.Empty(drain(w))
+
+	// A device seen only once is not reported
+	a.roms = roms
+	assert.NoError(w.poll(ctx))
+	a.roms = roms[:2]
+	assert.NoError(w.poll(ctx))
+	assert.Empty(drain(w))
+
+	a.roms = roms[1:]
+	assert.NoError(w.poll(ctx))
+	assert.Empty(drain(w))
+	assert.NoError(w.poll(ctx))
+	assert.Equal(map[Address]EventType{roms[0]: Departed, roms[2]: Arrived}, drain(w))
+
+	// Everything leaves
+	a.roms = nil
+	assert.NoError(w.poll(ctx))
+	assert.NoError(w.poll(ctx))
+	assert.Equal(map[Address]EventType{roms[1]: Departed, roms[2]: Departed}, drain(w))
+	assert.Empty(w.seen[0])
+}
+
+func TestWatcherRun(t *testing.T) {
+	assert := assert.New(t)
+
+	roms := mustParse(t, "28.000000000001.--")
+
+	good := NewBus(&tripletBus{roms: roms})
+	bad := NewBus(&shortedBus{})
+	w := NewWatcher(good, bad)
+	w.Interval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	var arrived, failed bool
+	for e := range w.Events() {
+		switch e.Type {
+		case Arrived:
+			assert.Equal(roms[0], e.Address)
+			assert.Equal(good.Adapter(), e.Adapter)
+			assert.False(e.Time.IsZero())
+			arrived = true
+		case SearchFailed:
+			assert.Equal(bad.Adapter(), e.Adapter)
+			assert.Equal(ErrBusShorted, e.Err)
+			failed = true
+		default:
+			t.Errorf("unexpected event %s", e.Type)
+		}
+		if arrived && failed {
+			cancel()
+		}
+	}
+
+	assert.Equal(context.Canceled, <-done)
+	assert.True(arrived)
+	assert.True(failed)
+}